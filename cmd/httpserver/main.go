@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -10,32 +11,47 @@ import (
 
 	"github.com/yanshuy/http/internal/request"
 	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/secure"
 	"github.com/yanshuy/http/internal/server"
 )
 
 func HandleRequest(w *response.Writer, r *request.Request) error {
 	switch r.RequestLine.Target {
 	case "/yourproblem":
-		w.WriteStatus(http.StatusBadRequest)
+		w.WriteStatus(response.StatusBadRequest)
 		msg := []byte("Your problem is not my problem\n")
 		w.Write(msg)
 
 	case "/myproblem":
-		w.WriteStatus(http.StatusInternalServerError)
+		w.WriteStatus(response.StatusInternalServerError)
 		msg := []byte("Woopsie, my bad\n")
 		w.Write(msg)
 
 	default:
 		if strings.HasPrefix(r.RequestLine.Target, "/httpbin") {
 			prefixLen := len("/httpbin")
-			resp, _ := http.Get("https://httpbin.org" + r.RequestLine.Target[prefixLen:])
+			url := "https://httpbin.org" + r.RequestLine.Target[prefixLen:]
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return server.WrapError(response.StatusBadGateway, err)
+			}
+			defer resp.Body.Close()
 			b := make([]byte, 32)
 			for {
 				n, err := resp.Body.Read(b)
-				w.Write(b[:n])
-				if err != nil {
+				if _, werr := w.Write(b[:n]); werr != nil {
+					return werr
+				}
+				if err == io.EOF {
 					break
 				}
+				if err != nil {
+					return err
+				}
 			}
 		} else {
 			w.Write([]byte("All good, frfr\n"))
@@ -45,7 +61,7 @@ func HandleRequest(w *response.Writer, r *request.Request) error {
 }
 
 func main() {
-	server, err := server.Serve(":42069", HandleRequest)
+	server, err := server.Serve(":42069", server.Chain(HandleRequest, secure.New()))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -2,7 +2,10 @@ module github.com/yanshuy/http
 
 go 1.23.4
 
-require github.com/stretchr/testify v1.10.0
+require (
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/crypto v0.40.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	Authorization   = "Authorization"
+	WWWAuthenticate = "WWW-Authenticate"
+)
+
+const defaultRealm = "restricted"
+
+// Principal is whoever a request was authenticated as.
+type Principal struct {
+	// Name is the user name, token subject or key id.
+	Name string
+	// Scheme is the authentication scheme used, e.g. "Basic".
+	Scheme string
+	// Claims holds what else the credentials said, e.g. token claims.
+	Claims map[string]any
+}
+
+type ctxKey struct{}
+
+// FromRequest returns the principal the request was authenticated as, nil
+// if it went through no auth middleware.
+func FromRequest(r *request.Request) *Principal {
+	p, _ := r.Context().Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// WithPrincipal returns a shallow copy of r authenticated as p.
+func WithPrincipal(r *request.Request, p *Principal) *request.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxKey{}, p))
+}
+
+type config struct {
+	realm         string
+	signedHeaders []string
+	maxSkew       time.Duration
+}
+
+type Option func(*config)
+
+// WithRealm sets the realm named in challenges, defaults to "restricted".
+func WithRealm(realm string) Option {
+	return func(c *config) {
+		c.realm = realm
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		realm:         defaultRealm,
+		signedHeaders: defaultSignedHeaders,
+		maxSkew:       defaultMaxSkew,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// credentials returns the credentials of the Authorization header of r if
+// it uses scheme, compared case-insensitively.
+func credentials(r *request.Request, scheme string) (string, bool) {
+	auth, ok := r.Headers.Get(Authorization)
+	if !ok {
+		return "", false
+	}
+	s, creds, _ := strings.Cut(strings.TrimSpace(auth), " ")
+	if !strings.EqualFold(s, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(creds), true
+}
+
+// authHeader builds a WWW-Authenticate or Authorization value, params
+// alternate names and values.
+func authHeader(scheme string, params ...string) string {
+	var b strings.Builder
+	b.WriteString(scheme)
+	for i := 0; i+1 < len(params); i += 2 {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(params[i] + "=" + quote(params[i+1]))
+	}
+	return b.String()
+}
+
+// quote makes s a quoted-string, RFC 9110 section 5.6.4
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// unauthorized returns a 401 asking for credentials with challenge.
+func unauthorized(challenge string, err error) error {
+	h := headers.NewHeaders()
+	h.Set(WWWAuthenticate, challenge)
+	return &server.HTTPError{
+		Status:  response.StatusUnauthorized,
+		Headers: h,
+		Err:     err,
+	}
+}
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newRequest(method, target string, hdrs ...string) *request.Request {
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: method, Target: target, HttpVersion: "1.1"}
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		r.Headers.Set(hdrs[i], hdrs[i+1])
+	}
+	return r
+}
+
+// run passes r through mw and returns the principal the handler saw
+func run(mw server.Middleware, r *request.Request) (*Principal, error) {
+	var p *Principal
+	err := mw(func(w *response.Writer, r *request.Request) error {
+		p = FromRequest(r)
+		return nil
+	})(response.NewResponseWriter(nil), r)
+	return p, err
+}
+
+func basic(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// requireChallenge checks err is a 401 with a challenge starting with prefix
+func requireChallenge(t *testing.T, err error, prefix string) {
+	t.Helper()
+	var httpErr *server.HTTPError
+	require.True(t, errors.As(err, &httpErr), "%v", err)
+	assert.Equal(t, response.StatusUnauthorized, httpErr.Status)
+	ch, _ := httpErr.Headers.Get(WWWAuthenticate)
+	assert.True(t, strings.HasPrefix(ch, prefix), ch)
+}
+
+func TestBasic(t *testing.T) {
+	mw := Basic(Users{"alice": "wonderland"}, WithRealm("admin"))
+
+	p, err := run(mw, newRequest("GET", "/", Authorization, basic("alice", "wonderland")))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "alice", Scheme: "Basic"}, p)
+
+	// Test: Scheme is case-insensitive
+	_, err = run(mw, newRequest("GET", "/", Authorization, "basic "+strings.TrimPrefix(basic("alice", "wonderland"), "Basic ")))
+	require.NoError(t, err)
+
+	// Test: Failures
+	for _, auth := range []string{"", basic("alice", "wonder"), basic("bob", "wonderland"), "Basic !!!", "Bearer x"} {
+		r := newRequest("GET", "/")
+		if auth != "" {
+			r.Headers.Set(Authorization, auth)
+		}
+		p, err := run(mw, r)
+		assert.Nil(t, p)
+		requireChallenge(t, err, `Basic realm="admin", charset="UTF-8"`)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	file := "# users\n\nalice:" + string(hash) + "\n"
+	store, err := ParseHtpasswd(strings.NewReader(file))
+	require.NoError(t, err)
+
+	assert.True(t, store.Authenticate("alice", "s3cret"))
+	assert.False(t, store.Authenticate("alice", "S3cret"))
+	assert.False(t, store.Authenticate("bob", "s3cret"))
+
+	// Test: Other hashes are rejected
+	_, err = ParseHtpasswd(strings.NewReader("alice:" + string(hash) + "\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+	assert.ErrorContains(t, err, "line 2")
+	_, err = ParseHtpasswd(strings.NewReader("no separator\n"))
+	assert.ErrorIs(t, err, ErrMalformedHtpasswd)
+}
+
+func TestBearer(t *testing.T) {
+	mw := Bearer(func(r *request.Request, token string) (*Principal, error) {
+		switch token {
+		case "good":
+			return &Principal{Name: "svc", Claims: map[string]any{"scope": "read"}}, nil
+		case "readonly":
+			return nil, server.NewError(response.StatusForbidden, "insufficient scope")
+		}
+		return nil, errors.New("token expired")
+	})
+
+	p, err := run(mw, newRequest("GET", "/", Authorization, "Bearer good"))
+	require.NoError(t, err)
+	assert.Equal(t, "svc", p.Name)
+	assert.Equal(t, "Bearer", p.Scheme)
+	assert.Equal(t, "read", p.Claims["scope"])
+
+	// Test: Missing token
+	_, err = run(mw, newRequest("GET", "/"))
+	requireChallenge(t, err, `Bearer realm="restricted"`)
+	_, err = run(mw, newRequest("GET", "/", Authorization, "Bearer "))
+	requireChallenge(t, err, `Bearer realm="restricted"`)
+
+	// Test: Invalid token
+	_, err = run(mw, newRequest("GET", "/", Authorization, "Bearer bad"))
+	requireChallenge(t, err, `Bearer realm="restricted", error="invalid_token", error_description="token expired"`)
+
+	// Test: Validator's own status
+	_, err = run(mw, newRequest("GET", "/", Authorization, "Bearer readonly"))
+	var httpErr *server.HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, response.StatusForbidden, httpErr.Status)
+}
+
+func TestHMAC(t *testing.T) {
+	secret := []byte("shared secret")
+	keys := func(id string) ([]byte, bool) {
+		return secret, id == "client-1"
+	}
+	mw := HMAC(keys)
+	signed := func(date time.Time, body string) *request.Request {
+		r := newRequest("POST", "/orders?dry=1", "Host", "api.example.com", Date, date.UTC().Format(headers.TimeFormat))
+		r.Body = []byte(body)
+		Sign(r, "client-1", secret, "Host", Date)
+		return r
+	}
+
+	p, err := run(mw, signed(time.Now(), `{"qty":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "client-1", Scheme: HMACScheme}, p)
+
+	// Test: Tampering
+	tampered := []func(r *request.Request){
+		func(r *request.Request) { r.Method = "PUT" },
+		func(r *request.Request) { r.Target = "/orders" },
+		func(r *request.Request) { r.Headers.Set("Host", "evil.example.com") },
+		func(r *request.Request) { r.Body = []byte(`{"qty":9}`) },
+		func(r *request.Request) {
+			r.Headers.Set(Date, time.Now().Add(time.Minute).UTC().Format(headers.TimeFormat))
+		},
+		func(r *request.Request) {
+			auth, _ := r.Headers.Get(Authorization)
+			r.Headers.Set(Authorization, strings.Replace(auth, "client-1", "client-2", 1))
+		},
+	}
+	for i, tamper := range tampered {
+		r := signed(time.Now(), `{"qty":1}`)
+		tamper(r)
+		_, err := run(mw, r)
+		requireChallenge(t, err, `HMAC-SHA256 realm="restricted", headers="host date"`)
+		assert.ErrorIs(t, err, ErrInvalidCredentials, i)
+	}
+
+	// Test: Replay window
+	_, err = run(mw, signed(time.Now().Add(-10*time.Minute), `{"qty":1}`))
+	assert.ErrorIs(t, err, ErrRequestExpired)
+	_, err = run(HMAC(keys, WithMaxSkew(0)), signed(time.Now().Add(-10*time.Minute), `{"qty":1}`))
+	assert.NoError(t, err)
+
+	// Test: Date is signed even when not configured
+	custom := HMAC(keys, WithSignedHeaders("Host", "X-Api"))
+	r := newRequest("GET", "/", "Host", "api.example.com", "X-Api", "v2", Date, time.Now().Add(-time.Minute).UTC().Format(headers.TimeFormat))
+	Sign(r, "client-1", secret, "Host", "X-Api")
+	_, err = run(custom, r)
+	requireChallenge(t, err, `HMAC-SHA256 realm="restricted", headers="host x-api date"`)
+	Sign(r, "client-1", secret, "Host", "X-Api", Date)
+	_, err = run(custom, r)
+	require.NoError(t, err)
+	r.Headers.Set(Date, time.Now().UTC().Format(headers.TimeFormat))
+	_, err = run(custom, r)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Test: Unsigned
+	_, err = run(mw, newRequest("GET", "/"))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+}
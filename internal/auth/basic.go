@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+// CredentialStore checks user names and passwords. Implementations should
+// take as long for unknown users as for wrong passwords.
+type CredentialStore interface {
+	Authenticate(user, password string) bool
+}
+
+// CredentialFunc adapts a function to a CredentialStore.
+type CredentialFunc func(user, password string) bool
+
+func (f CredentialFunc) Authenticate(user, password string) bool {
+	return f(user, password)
+}
+
+// BasicAuth returns the user name and password of the Basic Authorization
+// header of r.
+func BasicAuth(r *request.Request) (user, password string, ok bool) {
+	creds, ok := credentials(r, "Basic")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(creds)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// Basic returns a middleware requiring HTTP Basic authentication, RFC 7617,
+// against store. Requests without valid credentials get a 401 challenge.
+func Basic(store CredentialStore, opts ...Option) server.Middleware {
+	c := newConfig(opts)
+	ch := authHeader("Basic", "realm", c.realm, "charset", "UTF-8")
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			user, password, ok := BasicAuth(r)
+			if !ok {
+				return unauthorized(ch, ErrNoCredentials)
+			}
+			if !store.Authenticate(user, password) {
+				return unauthorized(ch, ErrInvalidCredentials)
+			}
+			return next(w, WithPrincipal(r, &Principal{Name: user, Scheme: "Basic"}))
+		}
+	}
+}
+
+// Users is a CredentialStore of plain text passwords by user name.
+type Users map[string]string
+
+// Authenticate compares in constant time, hashing first so that neither
+// the length of the password nor the existence of the user leaks.
+func (u Users) Authenticate(user, password string) bool {
+	want, ok := u[user]
+	got := sha256.Sum256([]byte(password))
+	expected := sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(got[:], expected[:]) == 1 && ok
+}
+
+// Htpasswd is a CredentialStore of bcrypt hashes in the htpasswd format,
+// one "user:hash" per line, as written by htpasswd -B.
+type Htpasswd struct {
+	hashes map[string][]byte
+}
+
+// LoadHtpasswd reads the htpasswd file at path.
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHtpasswd(f)
+}
+
+// ParseHtpasswd reads an htpasswd file. Blank lines and lines starting
+// with # are skipped, hashes other than bcrypt are an error.
+func ParseHtpasswd(r io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{hashes: make(map[string][]byte)}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("htpasswd line %d: %w", n, ErrMalformedHtpasswd)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("htpasswd line %d: %w", n, ErrUnsupportedHash)
+		}
+		h.hashes[user] = []byte(hash)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// dummyHash is compared against for unknown users, so they take as long
+// as known ones
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func (h *Htpasswd) Authenticate(user, password string) bool {
+	hash, ok := h.hashes[user]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+var (
+	ErrMalformedHtpasswd = errors.New("malformed htpasswd entry")
+	ErrUnsupportedHash   = errors.New("unsupported password hash, want bcrypt")
+)
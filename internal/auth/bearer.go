@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+// TokenValidator checks a bearer token and returns who it was issued to.
+// Returning a *server.HTTPError, e.g. a 403, answers the request with it,
+// any other error with a 401 invalid_token challenge.
+type TokenValidator func(r *request.Request, token string) (*Principal, error)
+
+// BearerToken returns the token of the Bearer Authorization header of r.
+func BearerToken(r *request.Request) (string, bool) {
+	token, ok := credentials(r, "Bearer")
+	return token, ok && token != ""
+}
+
+// Bearer returns a middleware requiring a bearer token, RFC 6750, that
+// validate accepts. Challenges carry the error codes of section 3.1.
+func Bearer(validate TokenValidator, opts ...Option) server.Middleware {
+	c := newConfig(opts)
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			token, ok := BearerToken(r)
+			if !ok {
+				return unauthorized(authHeader("Bearer", "realm", c.realm), ErrNoCredentials)
+			}
+			p, err := validate(r, token)
+			if err != nil {
+				var httpErr *server.HTTPError
+				if errors.As(err, &httpErr) {
+					return err
+				}
+				ch := authHeader("Bearer", "realm", c.realm, "error", "invalid_token", "error_description", err.Error())
+				return unauthorized(ch, err)
+			}
+			if p == nil {
+				p = &Principal{}
+			}
+			if p.Scheme == "" {
+				p.Scheme = "Bearer"
+			}
+			return next(w, WithPrincipal(r, p))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+// HMACScheme is the scheme of signed requests:
+//
+//	Authorization: HMAC-SHA256 keyId="client-1", signature="<base64>"
+const HMACScheme = "HMAC-SHA256"
+
+const Date = "Date"
+
+const defaultMaxSkew = 5 * time.Minute
+
+var defaultSignedHeaders = []string{"Host", Date}
+
+// KeyFunc returns the shared secret of keyID.
+type KeyFunc func(keyID string) ([]byte, bool)
+
+// WithSignedHeaders sets the headers HMAC signatures cover, defaults to
+// Host and Date. Date is added unless the max skew check is disabled, an
+// unsigned Date could be bumped to replay a request.
+func WithSignedHeaders(names ...string) Option {
+	return func(c *config) {
+		c.signedHeaders = names
+	}
+}
+
+// WithMaxSkew sets how far the Date of a signed request may be from now,
+// defaults to 5 minutes, 0 disables the check.
+func WithMaxSkew(d time.Duration) Option {
+	return func(c *config) {
+		c.maxSkew = d
+	}
+}
+
+// StringToSign returns what an HMAC signature of r covers: the method,
+// the target, each of signedHeaders as "name:value" and the hex SHA-256
+// digest of the body, one per line.
+func StringToSign(r *request.Request, signedHeaders []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method + "\n" + r.Target + "\n")
+	for _, name := range signedHeaders {
+		val, _ := r.Headers.Get(name)
+		b.WriteString(strings.ToLower(name) + ":" + strings.TrimSpace(val) + "\n")
+	}
+	digest := sha256.Sum256(r.Body)
+	b.WriteString(hex.EncodeToString(digest[:]))
+	return b.String()
+}
+
+// Sign sets the Authorization header of r to a signature with the secret
+// of keyID, clients must set the signed headers first.
+func Sign(r *request.Request, keyID string, secret []byte, signedHeaders ...string) {
+	sig := signature(secret, StringToSign(r, signedHeaders))
+	r.Headers.Set(Authorization, authHeader(HMACScheme, "keyId", keyID, "signature", base64.StdEncoding.EncodeToString(sig)))
+}
+
+func signature(secret []byte, s string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// HMAC returns a middleware requiring requests signed with the secret of
+// a key keys knows, see Sign. The Date header must be within the max skew
+// of the server's clock, so that captured requests can't be replayed for
+// long.
+func HMAC(keys KeyFunc, opts ...Option) server.Middleware {
+	c := newConfig(opts)
+	if c.maxSkew > 0 && !slices.ContainsFunc(c.signedHeaders, func(name string) bool {
+		return strings.EqualFold(name, Date)
+	}) {
+		c.signedHeaders = append(slices.Clip(c.signedHeaders), Date)
+	}
+	ch := authHeader(HMACScheme, "realm", c.realm, "headers", strings.ToLower(strings.Join(c.signedHeaders, " ")))
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			creds, ok := credentials(r, HMACScheme)
+			if !ok {
+				return unauthorized(ch, ErrNoCredentials)
+			}
+			params := parseParams(creds)
+			keyID := params["keyid"]
+			sig, err := base64.StdEncoding.DecodeString(params["signature"])
+			if err != nil || keyID == "" || len(sig) == 0 {
+				return unauthorized(ch, ErrInvalidCredentials)
+			}
+			secret, ok := keys(keyID)
+			if !ok {
+				return unauthorized(ch, ErrInvalidCredentials)
+			}
+			if c.maxSkew > 0 && !fresh(r, c.maxSkew) {
+				return unauthorized(ch, ErrRequestExpired)
+			}
+			if !hmac.Equal(sig, signature(secret, StringToSign(r, c.signedHeaders))) {
+				return unauthorized(ch, ErrInvalidCredentials)
+			}
+			return next(w, WithPrincipal(r, &Principal{Name: keyID, Scheme: HMACScheme}))
+		}
+	}
+}
+
+func fresh(r *request.Request, maxSkew time.Duration) bool {
+	date, ok := r.Headers.Get(Date)
+	if !ok {
+		return false
+	}
+	t, err := headers.ParseTime(date)
+	if err != nil {
+		return false
+	}
+	skew := time.Since(t)
+	return skew <= maxSkew && skew >= -maxSkew
+}
+
+// parseParams parses auth-params, names are lowercased
+func parseParams(s string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+	return params
+}
+
+var ErrRequestExpired = errors.New("request date outside the allowed skew")
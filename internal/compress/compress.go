@@ -0,0 +1,168 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yanshuy/http/internal/negotiate"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const AcceptEncoding = negotiate.AcceptEncoding
+
+const defaultMinSize = 1024
+
+// EncoderFunc wraps w so that everything written to the result reaches w
+// encoded. Close must flush whatever is still buffered.
+type EncoderFunc func(w io.Writer) io.WriteCloser
+
+type encoder struct {
+	name string
+	fn   EncoderFunc
+}
+
+func Gzip(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// Deflate is the "deflate" content coding, which is the zlib format.
+func Deflate(w io.Writer) io.WriteCloser {
+	return zlib.NewWriter(w)
+}
+
+// DefaultSkipTypes are content types that are already compressed.
+var DefaultSkipTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+}
+
+type compressor struct {
+	encoders  []encoder
+	minSize   int
+	skipTypes []string
+}
+
+type Option func(*compressor)
+
+// WithEncoder adds the content coding name, or replaces the one already
+// registered under it. When the client weighs codings equally the one
+// registered first wins, gzip and deflate are registered by default.
+func WithEncoder(name string, fn EncoderFunc) Option {
+	return func(c *compressor) {
+		name = strings.ToLower(name)
+		for i := range c.encoders {
+			if c.encoders[i].name == name {
+				c.encoders[i].fn = fn
+				return
+			}
+		}
+		c.encoders = append(c.encoders, encoder{name, fn})
+	}
+}
+
+// WithMinSize leaves responses with a Content-Length below n uncompressed,
+// defaults to 1024.
+func WithMinSize(n int) Option {
+	return func(c *compressor) {
+		c.minSize = n
+	}
+}
+
+// WithSkipTypes leaves responses whose Content-Type starts with any of
+// prefixes uncompressed, defaults to DefaultSkipTypes.
+func WithSkipTypes(prefixes ...string) Option {
+	return func(c *compressor) {
+		c.skipTypes = prefixes
+	}
+}
+
+// New returns a middleware compressing response bodies with the coding the
+// client prefers according to its Accept-Encoding header.
+func New(opts ...Option) server.Middleware {
+	c := &compressor{
+		encoders: []encoder{
+			{"gzip", Gzip},
+			{"deflate", Deflate},
+		},
+		minSize:   defaultMinSize,
+		skipTypes: DefaultSkipTypes,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			accept, _ := r.Headers.Get(AcceptEncoding)
+			enc, ok := c.negotiate(accept)
+			w.OnWriteHeaders(func(w *response.Writer) {
+				h := w.Headers()
+				h.AddToken(response.Vary, AcceptEncoding)
+				if !ok || !c.shouldCompress(w) {
+					return
+				}
+				h.Del(response.ContentLength)
+				h.Set(response.ContentEncoding, enc.name)
+				w.EncodeBody(enc.fn)
+			})
+			return next(w, r)
+		}
+	}
+}
+
+func (c *compressor) shouldCompress(w *response.Writer) bool {
+	if !response.BodyAllowed(w.StatusCode()) {
+		return false
+	}
+	h := w.Headers()
+	if _, ok := h.Get(response.ContentEncoding); ok {
+		return false
+	}
+	if cl, ok := h.Get(response.ContentLength); ok {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < c.minSize {
+			return false
+		}
+	}
+	ct, _ := h.Get(response.ContentType)
+	ct = strings.ToLower(ct)
+	for _, prefix := range c.skipTypes {
+		if strings.HasPrefix(ct, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// negotiate picks the encoder the client ranks highest, ties go to the
+// encoder registered first. No Accept-Encoding means no compression.
+func (c *compressor) negotiate(accept string) (encoder, bool) {
+	if accept == "" {
+		return encoder{}, false
+	}
+	names := make([]string, len(c.encoders))
+	for i, enc := range c.encoders {
+		names[i] = enc.name
+	}
+	name, ok := negotiate.BestEncoding(accept, names...)
+	if !ok {
+		return encoder{}, false
+	}
+	for _, enc := range c.encoders {
+		if enc.name == name {
+			return enc, true
+		}
+	}
+	return encoder{}, false
+}
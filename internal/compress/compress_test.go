@@ -0,0 +1,162 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+var payload = strings.Repeat("hello compression ", 100)
+
+type parsed struct {
+	headers headers.Headers
+	body    []byte
+}
+
+// parseResponse splits a raw response and undoes the chunked framing
+func parseResponse(t *testing.T, raw []byte) parsed {
+	t.Helper()
+	br := bufio.NewReader(bytes.NewReader(raw))
+	_, err := br.ReadString('\n')
+	require.NoError(t, err)
+
+	h := headers.NewHeaders()
+	n, done, err := h.Parse(raw[len(raw)-br.Buffered():])
+	require.NoError(t, err)
+	require.True(t, done)
+	rest := raw[len(raw)-br.Buffered()+n:]
+
+	if te, _ := h.Get(response.TransferEncoding); te != "chunked" {
+		return parsed{h, rest}
+	}
+	var body []byte
+	for {
+		line, after, ok := bytes.Cut(rest, []byte("\r\n"))
+		require.True(t, ok)
+		size, err := strconv.ParseInt(string(line), 16, 64)
+		require.NoError(t, err)
+		if size == 0 {
+			break
+		}
+		body = append(body, after[:size]...)
+		rest = after[size+2:]
+	}
+	return parsed{h, body}
+}
+
+func serve(t *testing.T, h server.Handler, accept string) parsed {
+	t.Helper()
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "GET", Target: "/", HttpVersion: "1.1"}
+	if accept != "" {
+		r.Headers.Set(AcceptEncoding, accept)
+	}
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(t, h(w, r))
+	require.NoError(t, w.Finish())
+	return parseResponse(t, buf.Bytes())
+}
+
+func writeBody(contentType string, contentLength bool) server.Handler {
+	return func(w *response.Writer, r *request.Request) error {
+		w.Headers().Set(response.ContentType, contentType)
+		if contentLength {
+			w.Headers().Set(response.ContentLength, strconv.Itoa(len(payload)))
+		}
+		for i := 0; i < len(payload); i += 100 {
+			if _, err := w.Write([]byte(payload[i:min(i+100, len(payload))])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestGzip(t *testing.T) {
+	h := New()(writeBody("text/plain", true))
+	p := serve(t, h, "deflate;q=0.5, gzip")
+	assert.Equal(t, "gzip", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", p.headers.GetTest("Vary"))
+	assert.Equal(t, "chunked", p.headers.GetTest("Transfer-Encoding"))
+	assert.Equal(t, "", p.headers.GetTest("Content-Length"))
+
+	zr, err := gzip.NewReader(bytes.NewReader(p.body))
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(body))
+}
+
+func TestDeflate(t *testing.T) {
+	h := New()(writeBody("application/json", false))
+	p := serve(t, h, "gzip;q=0.2, *;q=0.8")
+	assert.Equal(t, "deflate", p.headers.GetTest("Content-Encoding"))
+
+	zr, err := zlib.NewReader(bytes.NewReader(p.body))
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(body))
+}
+
+func TestSkip(t *testing.T) {
+	// Test: No Accept-Encoding
+	p := serve(t, New()(writeBody("text/plain", true)), "")
+	assert.Equal(t, "", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", p.headers.GetTest("Vary"))
+	assert.Equal(t, payload, string(p.body))
+
+	// Test: Nothing acceptable
+	p = serve(t, New()(writeBody("text/plain", true)), "br, gzip;q=0")
+	assert.Equal(t, "", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, payload, string(p.body))
+
+	// Test: Small body
+	p = serve(t, New(WithMinSize(len(payload)+1))(writeBody("text/plain", true)), "gzip")
+	assert.Equal(t, "", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(len(payload)), p.headers.GetTest("Content-Length"))
+	assert.Equal(t, payload, string(p.body))
+
+	// Test: Already compressed content type
+	p = serve(t, New()(writeBody("image/png", false)), "gzip")
+	assert.Equal(t, "", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, payload, string(p.body))
+
+	// Test: Empty body
+	p = serve(t, New()(func(w *response.Writer, r *request.Request) error { return nil }), "gzip")
+	assert.Equal(t, "", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, "0", p.headers.GetTest("Content-Length"))
+}
+
+type upperEncoder struct {
+	w io.Writer
+}
+
+func (u upperEncoder) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+func (u upperEncoder) Close() error {
+	return nil
+}
+
+func TestCustomEncoder(t *testing.T) {
+	upper := func(w io.Writer) io.WriteCloser { return upperEncoder{w} }
+	h := New(WithEncoder("upper", upper))(writeBody("text/plain", false))
+	p := serve(t, h, "upper, gzip;q=0.9")
+	assert.Equal(t, "upper", p.headers.GetTest("Content-Encoding"))
+	assert.Equal(t, strings.ToUpper(payload), string(p.body))
+}
@@ -0,0 +1,164 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const defaultMaxDecompressedSize = 10 << 20
+
+// DecoderFunc returns a reader decoding r.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+type decoder struct {
+	name string
+	fn   DecoderFunc
+}
+
+func GzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func DeflateDecoder(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+type decompressor struct {
+	decoders []decoder
+	maxSize  int64
+}
+
+type DecompressOption func(*decompressor)
+
+// WithDecoder adds the content coding name, or replaces the one already
+// registered under it. gzip and deflate are registered by default.
+func WithDecoder(name string, fn DecoderFunc) DecompressOption {
+	return func(d *decompressor) {
+		name = strings.ToLower(name)
+		for i := range d.decoders {
+			if d.decoders[i].name == name {
+				d.decoders[i].fn = fn
+				return
+			}
+		}
+		d.decoders = append(d.decoders, decoder{name, fn})
+	}
+}
+
+// WithMaxDecompressedSize caps the size of a decoded body, defaults to 10MiB.
+// It is what keeps a small compressed upload from blowing up in memory.
+func WithMaxDecompressedSize(n int64) DecompressOption {
+	return func(d *decompressor) {
+		d.maxSize = n
+	}
+}
+
+// Decompress returns a middleware decoding request bodies sent with a
+// Content-Encoding, handlers see the plain body and no Content-Encoding.
+// Unknown codings get a 415 Unsupported Media Type and bodies decoding past
+// the size limit a 413 Content Too Large.
+func Decompress(opts ...DecompressOption) server.Middleware {
+	d := &decompressor{
+		decoders: []decoder{
+			{"gzip", GzipDecoder},
+			{"deflate", DeflateDecoder},
+		},
+		maxSize: defaultMaxDecompressedSize,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			codings, ok := r.Headers.Get(response.ContentEncoding)
+			if !ok {
+				return next(w, r)
+			}
+
+			body, err := d.decode(codings, r.Body)
+			switch {
+			case errors.Is(err, ErrUnsupportedEncoding):
+				w.Headers().Set(AcceptEncoding, d.supported())
+				return reject(w, response.StatusUnsupportedMediaType, err)
+			case errors.Is(err, ErrBodyTooLarge):
+				return reject(w, response.StatusContentTooLarge, err)
+			case err != nil:
+				return reject(w, response.StatusBadRequest, err)
+			}
+
+			r.Body = body
+			r.Headers.Del(response.ContentEncoding)
+			r.Headers.Set(response.ContentLength, strconv.Itoa(len(body)))
+			return next(w, r)
+		}
+	}
+}
+
+// decode undoes codings, which are listed in the order they were applied.
+func (d *decompressor) decode(codings string, body []byte) ([]byte, error) {
+	names := strings.Split(codings, ",")
+	for i := len(names) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSpace(names[i]))
+		if name == "" || name == "identity" {
+			continue
+		}
+		dec, ok := d.decoder(name)
+		if !ok {
+			return nil, ErrUnsupportedEncoding
+		}
+
+		rc, err := dec.fn(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(io.LimitReader(rc, d.maxSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > d.maxSize {
+			return nil, ErrBodyTooLarge
+		}
+	}
+	return body, nil
+}
+
+func (d *decompressor) decoder(name string) (decoder, bool) {
+	for _, dec := range d.decoders {
+		if dec.name == name {
+			return dec, true
+		}
+	}
+	return decoder{}, false
+}
+
+func (d *decompressor) supported() string {
+	names := make([]string, 0, len(d.decoders)+1)
+	for _, dec := range d.decoders {
+		names = append(names, dec.name)
+	}
+	return strings.Join(append(names, "identity"), ", ")
+}
+
+func reject(w *response.Writer, statusCode int, err error) error {
+	if err := w.WriteStatus(statusCode); err != nil {
+		return err
+	}
+	_, werr := w.Write([]byte(err.Error() + "\n"))
+	return werr
+}
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrBodyTooLarge        = errors.New("decompressed body too large")
+)
@@ -0,0 +1,95 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func deflated(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func upload(t *testing.T, h server.Handler, encoding string, body []byte) string {
+	t.Helper()
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "POST", Target: "/", HttpVersion: "1.1"}
+	r.Headers.Set(response.ContentEncoding, encoding)
+	r.Body = body
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(t, h(w, r))
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func echoBody(w *response.Writer, r *request.Request) error {
+	_, hasEncoding := r.Headers.Get(response.ContentEncoding)
+	if hasEncoding {
+		return nil
+	}
+	_, err := w.Write(r.Body)
+	return err
+}
+
+func TestDecompress(t *testing.T) {
+	h := Decompress()(echoBody)
+	body := []byte(`{"hello":"world"}`)
+
+	resp := upload(t, h, "gzip", gzipped(t, body))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, string(body))
+
+	// Test: Stacked codings are undone last to first
+	resp = upload(t, h, "deflate, gzip", gzipped(t, deflated(t, body)))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, string(body))
+
+	// Test: Unknown coding
+	resp = upload(t, h, "br", body)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 415 Unsupported Media Type\r\n"))
+	assert.Contains(t, resp, "accept-encoding: gzip, deflate, identity\r\n")
+
+	// Test: Corrupt body
+	resp = upload(t, h, "gzip", body)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+}
+
+func TestDecompressLimit(t *testing.T) {
+	bomb := gzipped(t, make([]byte, 1<<20))
+	h := Decompress(WithMaxDecompressedSize(1 << 10))(echoBody)
+	resp := upload(t, h, "gzip", bomb)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	h = Decompress(WithMaxDecompressedSize(1 << 20))(func(w *response.Writer, r *request.Request) error {
+		assert.Len(t, r.Body, 1<<20)
+		assert.Equal(t, "1048576", r.Headers.GetTest(response.ContentLength))
+		return nil
+	})
+	resp = upload(t, h, "gzip", bomb)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+}
@@ -0,0 +1,222 @@
+package conditional
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	ETag              = "ETag"
+	LastModified      = "Last-Modified"
+	IfMatch           = "If-Match"
+	IfNoneMatch       = "If-None-Match"
+	IfModifiedSince   = "If-Modified-Since"
+	IfUnmodifiedSince = "If-Unmodified-Since"
+	IfRange           = "If-Range"
+	Range             = "Range"
+)
+
+// StrongETag quotes tag into a strong entity-tag, e.g. "v1".
+func StrongETag(tag string) string {
+	return `"` + tag + `"`
+}
+
+// WeakETag quotes tag into a weak entity-tag, e.g. W/"v1". Weak tags only
+// promise the representations are equivalent, not byte for byte equal.
+func WeakETag(tag string) string {
+	return `W/"` + tag + `"`
+}
+
+// StrongMatch reports whether both entity-tags are strong and identical,
+// RFC 9110 section 8.8.3.2.
+func StrongMatch(a, b string) bool {
+	return !isWeak(a) && !isWeak(b) && a == b
+}
+
+// WeakMatch reports whether the entity-tags are identical once their weak
+// indicators are ignored.
+func WeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func isWeak(tag string) bool {
+	return strings.HasPrefix(tag, "W/")
+}
+
+// Evaluate checks the preconditions of r against the current validators
+// of the target resource in the order of RFC 9110 section 13.2.2. It
+// returns 304 Not Modified or 412 Precondition Failed when the request
+// should not proceed, 0 when it should. etag is empty when the resource
+// has none, a resource that doesn't exist has neither etag nor
+// lastModified.
+func Evaluate(r *request.Request, etag string, lastModified time.Time) int {
+	h := r.Headers
+	lastModified = lastModified.Truncate(time.Second)
+	exists := etag != "" || !lastModified.IsZero()
+	safe := r.Method == "GET" || r.Method == "HEAD"
+
+	if im, ok := h.Get(IfMatch); ok {
+		if !matchList(im, etag, exists, StrongMatch) {
+			return response.StatusPreconditionFailed
+		}
+	} else if ius, ok := h.Get(IfUnmodifiedSince); ok && !lastModified.IsZero() {
+		if t, err := headers.ParseTime(ius); err == nil && lastModified.After(t) {
+			return response.StatusPreconditionFailed
+		}
+	}
+
+	if inm, ok := h.Get(IfNoneMatch); ok {
+		if matchList(inm, etag, exists, WeakMatch) {
+			if safe {
+				return response.StatusNotModified
+			}
+			return response.StatusPreconditionFailed
+		}
+	} else if ims, ok := h.Get(IfModifiedSince); ok && safe && !lastModified.IsZero() {
+		if t, err := headers.ParseTime(ims); err == nil && !lastModified.After(t) {
+			return response.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// matchList reports whether the If-Match or If-None-Match value list
+// matches etag, "*" matches any existing resource.
+func matchList(list, etag string, exists bool, match func(a, b string) bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return exists
+	}
+	if etag == "" {
+		return false
+	}
+	for _, tag := range parseETags(list) {
+		if match(tag, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags splits a list of entity-tags, which may contain commas
+// within their quotes. Parsing stops at the first malformed tag.
+func parseETags(list string) []string {
+	var tags []string
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return tags
+		}
+		tag, rest, ok := scanETag(list)
+		if !ok {
+			return tags
+		}
+		tags = append(tags, tag)
+		list = rest
+	}
+}
+
+func scanETag(s string) (tag, rest string, ok bool) {
+	opaque := strings.TrimPrefix(s, "W/")
+	if len(opaque) < 2 || opaque[0] != '"' {
+		return "", "", false
+	}
+	end := strings.IndexByte(opaque[1:], '"')
+	if end < 0 {
+		return "", "", false
+	}
+	n := len(s) - len(opaque) + end + 2
+	return s[:n], s[n:], true
+}
+
+// Check declares the validators of the response, then evaluates the
+// preconditions of r against them. When they fail it writes the 304 or
+// 412 status and reports done, the handler must return without writing
+// a body:
+//
+//	if done, err := conditional.Check(w, r, etag, modTime); done || err != nil {
+//		return err
+//	}
+//
+// Handlers changing state call it before acting, so a failed If-Match
+// keeps the change from happening.
+func Check(w *response.Writer, r *request.Request, etag string, lastModified time.Time) (done bool, err error) {
+	setValidators(w.Headers(), etag, lastModified)
+	code := Evaluate(r, etag, lastModified)
+	if code == 0 {
+		return false, nil
+	}
+	return true, w.WriteStatus(code)
+}
+
+func setValidators(h headers.Headers, etag string, lastModified time.Time) {
+	if etag != "" {
+		h.Set(ETag, etag)
+	}
+	if !lastModified.IsZero() {
+		h.Set(LastModified, lastModified.UTC().Format(headers.TimeFormat))
+	}
+}
+
+// New returns a middleware that evaluates the preconditions of GET and
+// HEAD requests against the ETag and Last-Modified headers the handler
+// sets, and replaces a 2xx response with 304 or 412 when they fail. The
+// handler still produces the whole body, which is dropped, use Check to
+// skip that work.
+func New() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			if r.Method != "GET" && r.Method != "HEAD" {
+				return next(w, r)
+			}
+			w.OnWriteHeaders(func(w *response.Writer) {
+				code := w.StatusCode()
+				if code < 200 || code > 299 {
+					// preconditions only apply to successful responses
+					return
+				}
+				etag, lastModified := validators(w.Headers())
+				if etag == "" && lastModified.IsZero() {
+					return
+				}
+				if code := Evaluate(r, etag, lastModified); code != 0 {
+					w.Replace(code)
+				}
+			})
+			return next(w, r)
+		}
+	}
+}
+
+func validators(h headers.Headers) (string, time.Time) {
+	etag, _ := h.Get(ETag)
+	var lastModified time.Time
+	if lm, ok := h.Get(LastModified); ok {
+		lastModified, _ = headers.ParseTime(lm)
+	}
+	return etag, lastModified
+}
+
+// RangeAllowed reports whether the Range header of r may be honored, i.e.
+// there is no If-Range or it still matches the representation. If-Range
+// requires a strong match, for a date the exact Last-Modified, RFC 9110
+// section 13.1.5. Otherwise the whole representation must be sent.
+func RangeAllowed(r *request.Request, etag string, lastModified time.Time) bool {
+	ir, ok := r.Headers.Get(IfRange)
+	if !ok {
+		return true
+	}
+	ir = strings.TrimSpace(ir)
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		return etag != "" && StrongMatch(ir, etag)
+	}
+	t, err := headers.ParseTime(ir)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return lastModified.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,172 @@
+package conditional
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+var modTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func newRequest(method string, hdrs ...string) *request.Request {
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: method, Target: "/doc", HttpVersion: "1.1"}
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		r.Headers.Add(hdrs[i], hdrs[i+1])
+	}
+	return r
+}
+
+func date(t time.Time) string {
+	return t.Format(headers.TimeFormat)
+}
+
+func TestEvaluate(t *testing.T) {
+	etag := StrongETag("v2")
+	cases := []struct {
+		name   string
+		method string
+		hdrs   []string
+		want   int
+	}{
+		{"no preconditions", "GET", nil, 0},
+
+		{"if-match hit", "PUT", []string{IfMatch, `"v1", "v2"`}, 0},
+		{"if-match miss", "PUT", []string{IfMatch, `"v1"`}, 412},
+		{"if-match weak never matches", "PUT", []string{IfMatch, `W/"v2"`}, 412},
+		{"if-match star", "PUT", []string{IfMatch, "*"}, 0},
+		{"if-match over multiple lines", "PUT", []string{IfMatch, `"v1"`, IfMatch, `"v2"`}, 0},
+		{"if-match comma in tag", "PUT", []string{IfMatch, `"a,b", "v2"`}, 0},
+
+		{"if-unmodified-since later", "PUT", []string{IfUnmodifiedSince, date(modTime.Add(time.Hour))}, 0},
+		{"if-unmodified-since earlier", "PUT", []string{IfUnmodifiedSince, date(modTime.Add(-time.Hour))}, 412},
+		{"if-unmodified-since invalid", "PUT", []string{IfUnmodifiedSince, "soon"}, 0},
+		{"if-match wins over if-unmodified-since", "PUT",
+			[]string{IfMatch, `"v2"`, IfUnmodifiedSince, date(modTime.Add(-time.Hour))}, 0},
+
+		{"if-none-match hit", "GET", []string{IfNoneMatch, `"v2"`}, 304},
+		{"if-none-match weak hit", "HEAD", []string{IfNoneMatch, `W/"v2"`}, 304},
+		{"if-none-match miss", "GET", []string{IfNoneMatch, `"v1"`}, 0},
+		{"if-none-match unsafe", "POST", []string{IfNoneMatch, "*"}, 412},
+
+		{"if-modified-since same", "GET", []string{IfModifiedSince, date(modTime)}, 304},
+		{"if-modified-since earlier", "GET", []string{IfModifiedSince, date(modTime.Add(-time.Second))}, 0},
+		{"if-modified-since unsafe", "POST", []string{IfModifiedSince, date(modTime)}, 0},
+		{"if-none-match wins over if-modified-since", "GET",
+			[]string{IfNoneMatch, `"v1"`, IfModifiedSince, date(modTime)}, 0},
+
+		{"if-match before if-none-match", "GET", []string{IfMatch, `"v1"`, IfNoneMatch, `"v2"`}, 412},
+	}
+	for _, c := range cases {
+		r := newRequest(c.method, c.hdrs...)
+		// sub-second precision isn't sent, so it must not count
+		assert.Equal(t, c.want, Evaluate(r, etag, modTime.Add(500*time.Millisecond)), c.name)
+	}
+
+	// Test: Star needs an existing resource
+	assert.Equal(t, 412, Evaluate(newRequest("PUT", IfMatch, "*"), "", time.Time{}))
+	assert.Equal(t, 0, Evaluate(newRequest("PUT", IfNoneMatch, "*"), "", time.Time{}))
+}
+
+func TestMatch(t *testing.T) {
+	assert.True(t, StrongMatch(`"1"`, `"1"`))
+	assert.False(t, StrongMatch(`W/"1"`, `"1"`))
+	assert.False(t, StrongMatch(`W/"1"`, `W/"1"`))
+	assert.True(t, WeakMatch(`W/"1"`, `"1"`))
+	assert.False(t, WeakMatch(`"1"`, `"2"`))
+
+	assert.Equal(t, []string{`"a"`, `W/"b,c"`}, parseETags(` "a" ,W/"b,c"`))
+	assert.Equal(t, []string{`"a"`}, parseETags(`"a", b`))
+}
+
+func TestCheck(t *testing.T) {
+	h := func(w *response.Writer, r *request.Request) error {
+		if done, err := Check(w, r, StrongETag("v1"), modTime); done || err != nil {
+			return err
+		}
+		_, err := w.Write([]byte("content"))
+		return err
+	}
+
+	// Test: Fresh
+	out := serve(t, h, newRequest("GET"))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "etag: \"v1\"\r\n")
+	assert.Contains(t, out, "last-modified: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\ncontent"))
+
+	// Test: Not modified
+	out = serve(t, h, newRequest("GET", IfNoneMatch, `"v1"`))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, out, "etag: \"v1\"\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: Precondition failed
+	out = serve(t, h, newRequest("PUT", IfMatch, `"v0"`))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 412 Precondition Failed\r\n"))
+	assert.Contains(t, out, "content-length: 0\r\n")
+}
+
+func TestMiddleware(t *testing.T) {
+	h := New()(func(w *response.Writer, r *request.Request) error {
+		w.Headers().Set(ETag, WeakETag("v1"))
+		w.Headers().Set(LastModified, date(modTime))
+		_, err := w.Write(bytes.Repeat([]byte("x"), 10000))
+		return err
+	})
+
+	// Test: Body dropped once the validators match
+	out := serve(t, h, newRequest("GET", IfNoneMatch, `"v1"`))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.NotContains(t, out, "transfer-encoding")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	out = serve(t, h, newRequest("HEAD", IfModifiedSince, date(modTime)))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+
+	// Test: Full response otherwise
+	out = serve(t, h, newRequest("GET", IfNoneMatch, `"v0"`))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, strings.Repeat("x", 10000-4096)+"\r\n0\r\n\r\n"))
+
+	// Test: Unsafe methods are left to Check
+	out = serve(t, h, newRequest("POST", IfMatch, `"v0"`))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Errors aren't touched
+	notFound := New()(func(w *response.Writer, r *request.Request) error {
+		w.Headers().Set(ETag, StrongETag("v1"))
+		return w.WriteStatus(response.StatusNotFound)
+	})
+	out = serve(t, notFound, newRequest("GET", IfNoneMatch, "*"))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+}
+
+func TestRangeAllowed(t *testing.T) {
+	etag := StrongETag("v1")
+	assert.True(t, RangeAllowed(newRequest("GET"), etag, modTime))
+	assert.True(t, RangeAllowed(newRequest("GET", IfRange, `"v1"`), etag, modTime))
+	assert.False(t, RangeAllowed(newRequest("GET", IfRange, `"v0"`), etag, modTime))
+	assert.False(t, RangeAllowed(newRequest("GET", IfRange, `W/"v1"`), WeakETag("v1"), modTime))
+	assert.True(t, RangeAllowed(newRequest("GET", IfRange, date(modTime)), etag, modTime))
+	assert.False(t, RangeAllowed(newRequest("GET", IfRange, date(modTime.Add(time.Hour))), etag, modTime))
+	assert.False(t, RangeAllowed(newRequest("GET", IfRange, date(modTime)), etag, time.Time{}))
+}
+
+func serve(t *testing.T, h server.Handler, r *request.Request) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	w.SetRequestMethod(r.Method)
+	require.NoError(t, h(w, r))
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
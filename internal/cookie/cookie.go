@@ -0,0 +1,235 @@
+package cookie
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+const Header = "Cookie"
+
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out, browsers treat it as Lax.
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+func (s SameSite) String() string {
+	switch s {
+	case SameSiteLax:
+		return "Lax"
+	case SameSiteStrict:
+		return "Strict"
+	case SameSiteNone:
+		return "None"
+	}
+	return ""
+}
+
+// Cookie is a cookie sent by the client, which only carries Name and
+// Value, or one to set with Set.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path   string
+	Domain string
+	// Expires is left out when zero.
+	Expires time.Time
+	// MaxAge is in seconds, zero leaves it out and a negative value deletes
+	// the cookie right away.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse returns the cookies of every Cookie header of r in order. Pairs
+// that break RFC 6265 are skipped.
+func Parse(r *request.Request) []*Cookie {
+	var cookies []*Cookie
+	for _, line := range r.Headers.Values(Header) {
+		cookies = append(cookies, ParseHeader(line)...)
+	}
+	return cookies
+}
+
+// ParseHeader parses the value of a Cookie header, "a=1; b=2".
+func ParseHeader(line string) []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(line, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !isToken(name) {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if !validValue(value) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// Get returns the first cookie of r called name.
+func Get(r *request.Request, name string) (*Cookie, error) {
+	for _, c := range Parse(r) {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
+
+// Set adds a Set-Cookie header for c to the response, it must be called
+// before the headers are written.
+func Set(w *response.Writer, c *Cookie) error {
+	line, err := c.SetCookie()
+	if err != nil {
+		return err
+	}
+	w.Headers().Add(response.SetCookie, line)
+	return nil
+}
+
+// Delete tells the client to drop the cookie called name, path and domain
+// must match the ones it was set with.
+func Delete(w *response.Writer, name, path, domain string) error {
+	return Set(w, &Cookie{Name: name, Path: path, Domain: domain, MaxAge: -1})
+}
+
+// Valid reports whether c can be sent in a Set-Cookie header.
+func (c *Cookie) Valid() error {
+	if !isToken(c.Name) {
+		return ErrInvalidName
+	}
+	if !validValue(c.Value) {
+		return ErrInvalidValue
+	}
+	if strings.ContainsFunc(c.Path, func(r rune) bool { return r < 0x20 || r == 0x7f || r == ';' }) {
+		return ErrInvalidPath
+	}
+	if c.Domain != "" && !validDomain(strings.TrimPrefix(c.Domain, ".")) {
+		return ErrInvalidDomain
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() < 1601 {
+		return ErrInvalidExpires
+	}
+	if (c.SameSite == SameSiteNone || c.Partitioned) && !c.Secure {
+		return ErrNotSecure
+	}
+	// cookie prefixes, RFC 6265bis section 4.1.3
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return ErrNotSecure
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Path != "/" || c.Domain != "") {
+		return ErrHostPrefix
+	}
+	return nil
+}
+
+// SetCookie returns the Set-Cookie header value for c.
+func (c *Cookie) SetCookie() (string, error) {
+	if err := c.Valid(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name + "=" + c.Value)
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(headers.TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.SameSite != SameSiteDefault {
+		b.WriteString("; SameSite=" + c.SameSite.String())
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String(), nil
+}
+
+// isToken reports whether s is an RFC 9110 token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validValue reports whether s consists of cookie-octets only
+func validValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func validDomain(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var (
+	ErrNoCookie       = errors.New("cookie: not present")
+	ErrInvalidName    = errors.New("cookie: invalid name")
+	ErrInvalidValue   = errors.New("cookie: invalid value")
+	ErrInvalidPath    = errors.New("cookie: invalid path")
+	ErrInvalidDomain  = errors.New("cookie: invalid domain")
+	ErrInvalidExpires = errors.New("cookie: invalid expires")
+	ErrNotSecure      = errors.New("cookie: SameSite=None, Partitioned and __Secure- need Secure")
+	ErrHostPrefix     = errors.New("cookie: __Host- needs Secure, Path=/ and no Domain")
+)
@@ -0,0 +1,86 @@
+package cookie
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+func TestParse(t *testing.T) {
+	r := request.NewRequest()
+	r.Headers.Add(Header, `session=abc123; theme="dark"; bad name=x; empty=; noequals`)
+	r.Headers.Add(Header, "lang=en; bad=a,b")
+
+	cookies := Parse(r)
+	var pairs []string
+	for _, c := range cookies {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	assert.Equal(t, []string{"session=abc123", "theme=dark", "empty=", "lang=en"}, pairs)
+
+	c, err := Get(r, "lang")
+	require.NoError(t, err)
+	assert.Equal(t, "en", c.Value)
+	_, err = Get(r, "missing")
+	assert.Equal(t, ErrNoCookie, err)
+}
+
+func TestSetCookie(t *testing.T) {
+	c := &Cookie{
+		Name:        "__Host-id",
+		Value:       "42",
+		Path:        "/",
+		Expires:     time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	line, err := c.SetCookie()
+	require.NoError(t, err)
+	assert.Equal(t, "__Host-id=42; Path=/; Expires=Wed, 02 Jan 2030 03:04:05 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", line)
+
+	line, err = (&Cookie{Name: "a", Value: "b", Domain: ".example.com", MaxAge: -1, SameSite: SameSiteLax}).SetCookie()
+	require.NoError(t, err)
+	assert.Equal(t, "a=b; Domain=example.com; Max-Age=0; SameSite=Lax", line)
+
+	for _, tc := range []struct {
+		cookie Cookie
+		err    error
+	}{
+		{Cookie{Name: "", Value: "x"}, ErrInvalidName},
+		{Cookie{Name: "a b", Value: "x"}, ErrInvalidName},
+		{Cookie{Name: "a", Value: "x;y"}, ErrInvalidValue},
+		{Cookie{Name: "a", Path: "/x;y"}, ErrInvalidPath},
+		{Cookie{Name: "a", Domain: "exa mple.com"}, ErrInvalidDomain},
+		{Cookie{Name: "a", SameSite: SameSiteNone}, ErrNotSecure},
+		{Cookie{Name: "__Secure-a"}, ErrNotSecure},
+		{Cookie{Name: "__Host-a", Secure: true, Path: "/app"}, ErrHostPrefix},
+	} {
+		_, err := tc.cookie.SetCookie()
+		assert.Equal(t, tc.err, err, tc.cookie.Name)
+	}
+}
+
+func TestSetHeaderLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(t, Set(w, &Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, Set(w, &Cookie{Name: "b", Value: "2"}))
+	require.NoError(t, Delete(w, "c", "/", ""))
+	assert.Equal(t, ErrInvalidName, Set(w, &Cookie{Name: "d;"}))
+	require.NoError(t, w.Finish())
+
+	raw := buf.String()
+	assert.Contains(t, raw, "set-cookie: a=1; HttpOnly\r\n")
+	assert.Contains(t, raw, "set-cookie: b=2\r\n")
+	assert.Contains(t, raw, "set-cookie: c=; Path=/; Max-Age=0\r\n")
+	assert.Equal(t, 3, strings.Count(raw, "set-cookie:"))
+}
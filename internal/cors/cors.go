@@ -0,0 +1,234 @@
+package cors
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	Origin                        = "Origin"
+	AccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	AccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	AccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	AccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	AccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	AccessControlMaxAge           = "Access-Control-Max-Age"
+	AccessControlRequestMethod    = "Access-Control-Request-Method"
+	AccessControlRequestHeaders   = "Access-Control-Request-Headers"
+)
+
+// OriginFunc decides whether requests from origin are allowed.
+type OriginFunc func(origin string, r *request.Request) bool
+
+type cors struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	patterns    []pattern
+	originFunc  OriginFunc
+	methods     []string
+	headers     []string
+	anyHeader   bool
+	exposed     []string
+	credentials bool
+	maxAge      time.Duration
+}
+
+// pattern is an origin with one "*" standing for a non-empty part of it,
+// e.g. https://*.example.com
+type pattern struct {
+	prefix, suffix string
+}
+
+func (p pattern) match(origin string) bool {
+	return len(origin) > len(p.prefix)+len(p.suffix) &&
+		strings.HasPrefix(origin, p.prefix) && strings.HasSuffix(origin, p.suffix)
+}
+
+type Option func(*cors)
+
+// WithOrigins sets the origins allowed, compared case-insensitively.
+// An origin may contain one "*" matching any non-empty part of it, e.g.
+// "https://*.example.com", "*" alone allows any origin, the default.
+func WithOrigins(origins ...string) Option {
+	return func(c *cors) {
+		c.anyOrigin = false
+		c.origins = make(map[string]bool)
+		c.patterns = nil
+		for _, origin := range origins {
+			origin = strings.ToLower(origin)
+			if origin == "*" {
+				c.anyOrigin = true
+			} else if prefix, suffix, ok := strings.Cut(origin, "*"); ok {
+				c.patterns = append(c.patterns, pattern{prefix, suffix})
+			} else {
+				c.origins[origin] = true
+			}
+		}
+	}
+}
+
+// WithOriginFunc allows the origins fn accepts, in addition to those set
+// with WithOrigins. Using it alone allows no other origin.
+func WithOriginFunc(fn OriginFunc) Option {
+	return func(c *cors) {
+		c.originFunc = fn
+		if c.origins == nil {
+			c.anyOrigin = false
+		}
+	}
+}
+
+// WithMethods sets the methods allowed, defaults to GET, HEAD and POST.
+func WithMethods(methods ...string) Option {
+	return func(c *cors) {
+		c.methods = methods
+	}
+}
+
+// WithHeaders sets the request headers allowed, defaults to Accept,
+// Accept-Language, Content-Language and Content-Type. "*" allows any.
+func WithHeaders(headers ...string) Option {
+	return func(c *cors) {
+		c.headers = nil
+		c.anyHeader = false
+		for _, h := range headers {
+			if h == "*" {
+				c.anyHeader = true
+			}
+			c.headers = append(c.headers, strings.ToLower(h))
+		}
+	}
+}
+
+// WithExposedHeaders sets the response headers scripts may read besides
+// the safelisted ones.
+func WithExposedHeaders(headers ...string) Option {
+	return func(c *cors) {
+		c.exposed = headers
+	}
+}
+
+// WithCredentials allows requests with cookies or HTTP authentication.
+// The allowed origin is then echoed, browsers reject "*". It requires
+// the origins to be listed with WithOrigins or WithOriginFunc.
+func WithCredentials() Option {
+	return func(c *cors) {
+		c.credentials = true
+	}
+}
+
+// WithMaxAge lets browsers cache preflight results for d.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *cors) {
+		c.maxAge = d
+	}
+}
+
+// New returns a middleware implementing CORS. Preflight requests are
+// answered with 204 No Content and never reach the handler, the allow
+// headers are left out when the origin, method or a header is not
+// allowed, which makes the browser fail the request. New panics when
+// credentials are allowed from any origin, that would let every site
+// read responses on behalf of the user.
+func New(opts ...Option) server.Middleware {
+	c := &cors{
+		anyOrigin: true,
+		methods:   []string{"GET", "HEAD", "POST"},
+		headers:   []string{"accept", "accept-language", "content-language", "content-type"},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.credentials && c.anyOrigin {
+		panic("cors: credentials need an explicit list of origins")
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			origin, hasOrigin := r.Headers.Get(Origin)
+			reqMethod, isPreflight := r.Headers.Get(AccessControlRequestMethod)
+			isPreflight = isPreflight && hasOrigin && r.Method == "OPTIONS"
+
+			h := w.Headers()
+			h.AddToken(response.Vary, Origin)
+			if isPreflight {
+				h.AddToken(response.Vary, AccessControlRequestMethod)
+				h.AddToken(response.Vary, AccessControlRequestHeaders)
+				reqHeaders, _ := r.Headers.Get(AccessControlRequestHeaders)
+				if c.allowOrigin(origin, r) && c.allowMethod(reqMethod) && c.allowHeaders(reqHeaders) {
+					c.setOrigin(w, origin)
+					h.Set(AccessControlAllowMethods, strings.Join(c.methods, ", "))
+					if reqHeaders != "" {
+						h.Set(AccessControlAllowHeaders, reqHeaders)
+					}
+					if c.maxAge > 0 {
+						h.Set(AccessControlMaxAge, strconv.Itoa(int(c.maxAge.Seconds())))
+					}
+				}
+				return w.WriteStatus(response.StatusNoContent)
+			}
+
+			if hasOrigin && c.allowOrigin(origin, r) {
+				c.setOrigin(w, origin)
+				if len(c.exposed) > 0 {
+					h.Set(AccessControlExposeHeaders, strings.Join(c.exposed, ", "))
+				}
+			}
+			return next(w, r)
+		}
+	}
+}
+
+func (c *cors) setOrigin(w *response.Writer, origin string) {
+	h := w.Headers()
+	if c.credentials {
+		h.Set(AccessControlAllowCredentials, "true")
+	}
+	if c.anyOrigin {
+		h.Set(AccessControlAllowOrigin, "*")
+		return
+	}
+	h.Set(AccessControlAllowOrigin, origin)
+}
+
+func (c *cors) allowOrigin(origin string, r *request.Request) bool {
+	if c.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if c.origins[lower] {
+		return true
+	}
+	for _, p := range c.patterns {
+		if p.match(lower) {
+			return true
+		}
+	}
+	return c.originFunc != nil && c.originFunc(origin, r)
+}
+
+// allowMethod compares case-sensitively, as methods are
+func (c *cors) allowMethod(method string) bool {
+	return slices.Contains(c.methods, method)
+}
+
+// allowHeaders checks the comma separated list of headers a preflight
+// asks for
+func (c *cors) allowHeaders(list string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(c.headers, name) {
+			return false
+		}
+	}
+	return true
+}
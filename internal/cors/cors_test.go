@@ -0,0 +1,167 @@
+package cors
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+type result struct {
+	status  string
+	headers headers.Headers
+	reached bool
+}
+
+func serve(t *testing.T, mw server.Middleware, method string, hdrs ...string) result {
+	t.Helper()
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: method, Target: "/", HttpVersion: "1.1"}
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		r.Headers.Set(hdrs[i], hdrs[i+1])
+	}
+	var res result
+	h := mw(func(w *response.Writer, r *request.Request) error {
+		res.reached = true
+		_, err := w.Write([]byte("ok"))
+		return err
+	})
+
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(t, h(w, r))
+	require.NoError(t, w.Finish())
+	status, rest, _ := strings.Cut(buf.String(), "\r\n")
+	res.status = status
+	res.headers = headers.NewHeaders()
+	_, _, err := res.headers.Parse([]byte(rest))
+	require.NoError(t, err)
+	return res
+}
+
+func TestSimpleRequest(t *testing.T) {
+	// Test: Any origin by default
+	res := serve(t, New(), "GET", Origin, "https://app.example.com")
+	assert.True(t, res.reached)
+	assert.Equal(t, "*", res.headers.GetTest(AccessControlAllowOrigin))
+	assert.Equal(t, "Origin", res.headers.GetTest("Vary"))
+
+	// Test: No Origin, not a CORS request
+	res = serve(t, New(), "GET")
+	assert.True(t, res.reached)
+	assert.Equal(t, "", res.headers.GetTest(AccessControlAllowOrigin))
+	assert.Equal(t, "Origin", res.headers.GetTest("Vary"))
+
+	// Test: Credentials echo the origin
+	mw := New(WithOrigins("https://app.example.com"), WithCredentials(), WithExposedHeaders("X-Request-Id", "ETag"))
+	res = serve(t, mw, "POST", Origin, "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", res.headers.GetTest(AccessControlAllowOrigin))
+	assert.Equal(t, "true", res.headers.GetTest(AccessControlAllowCredentials))
+	assert.Equal(t, "X-Request-Id, ETag", res.headers.GetTest(AccessControlExposeHeaders))
+
+	res = serve(t, mw, "POST", Origin, "https://evil.example")
+	assert.Equal(t, "", res.headers.GetTest(AccessControlAllowOrigin))
+	assert.Equal(t, "", res.headers.GetTest(AccessControlAllowCredentials))
+
+	// Test: Credentials from any origin are refused
+	assert.Panics(t, func() { New(WithCredentials()) })
+	assert.Panics(t, func() { New(WithOrigins("*"), WithCredentials()) })
+	assert.NotPanics(t, func() {
+		New(WithCredentials(), WithOriginFunc(func(string, *request.Request) bool { return false }))
+	})
+}
+
+func TestOrigins(t *testing.T) {
+	mw := New(
+		WithOrigins("https://app.example.com", "https://*.example.org"),
+		WithOriginFunc(func(origin string, r *request.Request) bool {
+			return strings.HasSuffix(origin, ".internal")
+		}),
+	)
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"https://evil.example.com", false},
+		{"https://a.b.example.org", true},
+		{"https://.example.org", false},
+		{"https://example.org", false},
+		{"http://build.internal", true},
+		{"null", false},
+	}
+	for _, c := range cases {
+		res := serve(t, mw, "GET", Origin, c.origin)
+		assert.True(t, res.reached, c.origin)
+		if c.allowed {
+			assert.Equal(t, c.origin, res.headers.GetTest(AccessControlAllowOrigin), c.origin)
+		} else {
+			assert.Equal(t, "", res.headers.GetTest(AccessControlAllowOrigin), c.origin)
+		}
+	}
+
+	// Test: A function alone allows nothing else
+	mw = New(WithOriginFunc(func(string, *request.Request) bool { return false }))
+	res := serve(t, mw, "GET", Origin, "https://app.example.com")
+	assert.Equal(t, "", res.headers.GetTest(AccessControlAllowOrigin))
+}
+
+func TestPreflight(t *testing.T) {
+	mw := New(
+		WithOrigins("https://app.example.com"),
+		WithMethods("GET", "PUT", "DELETE"),
+		WithHeaders("Content-Type", "Authorization"),
+		WithMaxAge(10*time.Minute),
+	)
+
+	// Test: Allowed
+	res := serve(t, mw, "OPTIONS",
+		Origin, "https://app.example.com",
+		AccessControlRequestMethod, "PUT",
+		AccessControlRequestHeaders, "authorization, content-type",
+	)
+	assert.False(t, res.reached)
+	assert.Equal(t, "HTTP/1.1 204 No Content", res.status)
+	assert.Equal(t, "https://app.example.com", res.headers.GetTest(AccessControlAllowOrigin))
+	assert.Equal(t, "GET, PUT, DELETE", res.headers.GetTest(AccessControlAllowMethods))
+	assert.Equal(t, "authorization, content-type", res.headers.GetTest(AccessControlAllowHeaders))
+	assert.Equal(t, "600", res.headers.GetTest(AccessControlMaxAge))
+	assert.Equal(t, "Origin,Access-Control-Request-Method,Access-Control-Request-Headers", res.headers.GetTest("Vary"))
+
+	// Test: Rejected preflights get no allow headers
+	rejected := [][]string{
+		{Origin, "https://evil.example.com", AccessControlRequestMethod, "PUT"},
+		{Origin, "https://app.example.com", AccessControlRequestMethod, "PATCH"},
+		{Origin, "https://app.example.com", AccessControlRequestMethod, "put"},
+		{Origin, "https://app.example.com", AccessControlRequestMethod, "PUT", AccessControlRequestHeaders, "X-Debug"},
+	}
+	for _, hdrs := range rejected {
+		res := serve(t, mw, "OPTIONS", hdrs...)
+		assert.False(t, res.reached)
+		assert.Equal(t, "HTTP/1.1 204 No Content", res.status)
+		assert.Equal(t, "", res.headers.GetTest(AccessControlAllowOrigin))
+		assert.Equal(t, "", res.headers.GetTest(AccessControlAllowMethods))
+	}
+
+	// Test: Any header
+	res = serve(t, New(WithHeaders("*")), "OPTIONS",
+		Origin, "https://app.example.com",
+		AccessControlRequestMethod, "POST",
+		AccessControlRequestHeaders, "X-Debug",
+	)
+	assert.Equal(t, "*", res.headers.GetTest(AccessControlAllowOrigin))
+	assert.Equal(t, "X-Debug", res.headers.GetTest(AccessControlAllowHeaders))
+
+	// Test: Plain OPTIONS reaches the handler
+	res = serve(t, mw, "OPTIONS", Origin, "https://app.example.com")
+	assert.True(t, res.reached)
+	assert.Equal(t, "https://app.example.com", res.headers.GetTest(AccessControlAllowOrigin))
+}
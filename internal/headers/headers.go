@@ -4,12 +4,28 @@ import (
 	"bytes"
 	"errors"
 	"strings"
+	"time"
 	"unicode"
 )
 
 var Crlf = []byte("\r\n")
 var CrlfLen = len(Crlf)
 
+// TimeFormat is the format of dates in headers, RFC 9110 section 5.6.7.
+// Times must be in UTC.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// ParseTime parses a date in TimeFormat or in one of the two obsolete
+// formats recipients must still accept, RFC 850 and asctime.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, time.RFC850, time.ANSIC} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, ErrInvalidTime
+}
+
 type Headers map[string][]string
 
 func NewHeaders() Headers {
@@ -28,6 +44,11 @@ func (h Headers) GetTest(key string) string {
 	return str
 }
 
+// Values returns the values of every line of key, without joining them.
+func (h Headers) Values(key string) []string {
+	return h[strings.ToLower(key)]
+}
+
 func (h Headers) Add(key, val string) {
 	lower := strings.ToLower(key)
 	h[lower] = append(h[lower], val)
@@ -38,6 +59,20 @@ func (h Headers) Set(key, val string) {
 	h[lower] = []string{val}
 }
 
+// AddToken adds token to the comma separated list under key unless it is
+// already there, e.g. for Vary or Connection.
+func (h Headers) AddToken(key, token string) {
+	lower := strings.ToLower(key)
+	for _, val := range h[lower] {
+		for _, t := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return
+			}
+		}
+	}
+	h[lower] = append(h[lower], token)
+}
+
 func (h Headers) Del(key string) {
 	lower := strings.ToLower(key)
 	delete(h, lower)
@@ -90,4 +125,7 @@ func (h Headers) ParseHearderLine(line []byte) (err error) {
 	return nil
 }
 
-var ErrMalformedRequestHeader = errors.New("malformed request header")
+var (
+	ErrMalformedRequestHeader = errors.New("malformed request header")
+	ErrInvalidTime            = errors.New("invalid HTTP date")
+)
@@ -2,6 +2,7 @@ package headers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,3 +37,31 @@ func TestHeadersParser(t *testing.T) {
 	assert.Equal(t, "Barbar,Barbar2", headers.GetTest("FooFoo"))
 	assert.True(t, done)
 }
+
+func TestAddToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.AddToken("Vary", "Origin")
+	headers.AddToken("vary", "Accept-Encoding")
+	headers.AddToken("Vary", "origin")
+	assert.Equal(t, "Origin,Accept-Encoding", headers.GetTest("Vary"))
+
+	headers.Set("Vary", "Origin, Accept-Language")
+	headers.AddToken("Vary", "accept-language")
+	assert.Equal(t, "Origin, Accept-Language", headers.GetTest("Vary"))
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, s := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(s)
+		require.NoError(t, err, s)
+		assert.True(t, want.Equal(got), s)
+	}
+
+	_, err := ParseTime("yesterday")
+	assert.ErrorIs(t, err, ErrInvalidTime)
+}
@@ -0,0 +1,267 @@
+package jsonio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/yanshuy/http/internal/negotiate"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	ContentType = "application/json"
+	TextType    = "text/plain; charset=utf-8"
+	Accept      = negotiate.Accept
+)
+
+const defaultMaxBytes = 1 << 20
+
+type decoder struct {
+	maxBytes     int
+	allowUnknown bool
+}
+
+type DecodeOption func(*decoder)
+
+// WithMaxBytes rejects bodies larger than n bytes, defaults to 1MiB.
+func WithMaxBytes(n int) DecodeOption {
+	return func(d *decoder) {
+		d.maxBytes = n
+	}
+}
+
+// AllowUnknownFields ignores object keys that don't match a field of the
+// target, by default they are an error.
+func AllowUnknownFields() DecodeOption {
+	return func(d *decoder) {
+		d.allowUnknown = true
+	}
+}
+
+// Decode unmarshals the JSON body of r into v. The errors it returns are
+// *server.HTTPError, a 415 for other content types, a 413 for bodies over
+// the limit and a 400 naming the offending field for anything else.
+func Decode(r *request.Request, v any, opts ...DecodeOption) error {
+	d := decoder{maxBytes: defaultMaxBytes}
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	ct, _ := r.Headers.Get(response.ContentType)
+	if mediaType, _, err := mime.ParseMediaType(ct); err != nil || !isJSON(mediaType) {
+		return server.NewError(response.StatusUnsupportedMediaType, "Content-Type must be "+ContentType)
+	}
+	if len(r.Body) > d.maxBytes {
+		return server.NewError(response.StatusContentTooLarge, "body larger than "+strconv.Itoa(d.maxBytes)+" bytes")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(r.Body))
+	if !d.allowUnknown {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return badRequest(err, r.Body, v)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return server.NewError(response.StatusBadRequest, "body must hold a single JSON value")
+	}
+	return nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == ContentType || strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// badRequest turns a decoding error into a 400 that tells the client what
+// to fix without leaking Go type names. Fields are named by their path
+// from the top of body, e.g. "maker.country".
+func badRequest(err error, body []byte, v any) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var msg string
+	switch {
+	case errors.Is(err, io.EOF):
+		msg = "empty body"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		msg = "truncated JSON"
+	case errors.As(err, &syntaxErr):
+		msg = fmt.Sprintf("invalid JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		msg = fmt.Sprintf("field %q must be %s, got %s", field, jsonType(typeErr.Type.Kind()), typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		key, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		msg = fmt.Sprintf("unknown field %q", unknownFieldPath(body, reflect.TypeOf(v), key))
+	default:
+		msg = "invalid JSON"
+	}
+	return &server.HTTPError{Status: response.StatusBadRequest, Message: msg, Err: err}
+}
+
+// unknownFieldPath finds the path of the first key of body that doesn't
+// match a field of t, encoding/json only reports the key itself. It falls
+// back to key if the walk doesn't find it.
+func unknownFieldPath(body []byte, t reflect.Type, key string) string {
+	if path, ok := findUnknown(json.NewDecoder(bytes.NewReader(body)), t, key, ""); ok {
+		return path
+	}
+	return key
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// findUnknown reads the next value of dec, which is decoded into t at path.
+// t is nil where encoding/json doesn't check fields, e.g. for any.
+func findUnknown(dec *json.Decoder, t reflect.Type, key, path string) (string, bool) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", false
+	}
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && reflect.PointerTo(t).Implements(unmarshalerType) {
+		t = nil
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return "", false
+			}
+			k, _ := tok.(string)
+			fieldPath := k
+			if path != "" {
+				fieldPath = path + "." + k
+			}
+			var ft reflect.Type
+			switch {
+			case t == nil:
+			case t.Kind() == reflect.Struct:
+				f, ok := fieldType(t, k)
+				if !ok && k == key {
+					return fieldPath, true
+				}
+				ft = f
+			case t.Kind() == reflect.Map:
+				ft = t.Elem()
+			}
+			if p, ok := findUnknown(dec, ft, key, fieldPath); ok {
+				return p, true
+			}
+		}
+		dec.Token()
+	case json.Delim('['):
+		var et reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			et = t.Elem()
+		}
+		for dec.More() {
+			if p, ok := findUnknown(dec, et, key, path); ok {
+				return p, true
+			}
+		}
+		dec.Token()
+	}
+	return "", false
+}
+
+// fieldType returns the type of the field of struct t that key decodes
+// into, matching names like encoding/json: exactly, else case-insensitively.
+func fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	var folded reflect.Type
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			if f.Anonymous && (f.Type.Kind() == reflect.Struct ||
+				f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct) {
+				// its fields are promoted
+				continue
+			}
+			name = f.Name
+		}
+		if name == key {
+			return f.Type, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = f.Type
+		}
+	}
+	return folded, folded != nil
+}
+
+// jsonType names a Go kind the way a JSON client thinks of it
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return kind.String()
+}
+
+// JSON writes v as JSON.
+func JSON(w *response.Writer, status int, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return write(w, status, ContentType, append(data, '\n'))
+}
+
+// Text writes v as plain text, formatted with %v.
+func Text(w *response.Writer, status int, v any) error {
+	return write(w, status, TextType, []byte(fmt.Sprintln(v)))
+}
+
+func write(w *response.Writer, status int, contentType string, body []byte) error {
+	h := w.Headers()
+	h.Set(response.ContentType, contentType)
+	h.Set(response.ContentLength, strconv.Itoa(len(body)))
+	if err := w.WriteStatus(status); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// Respond writes v with the renderer r's Accept header prefers, JSON when
+// it doesn't care. Clients accepting neither get a 406.
+func Respond(w *response.Writer, r *request.Request, status int, v any) error {
+	w.Headers().AddToken(response.Vary, Accept)
+	mediaType, err := negotiate.MediaType(r, ContentType, "text/plain")
+	if err != nil {
+		return err
+	}
+	if mediaType == ContentType {
+		return JSON(w, status, v)
+	}
+	return Text(w, status, v)
+}
@@ -0,0 +1,109 @@
+package jsonio
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+type item struct {
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+	Maker struct {
+		Country string `json:"country"`
+	} `json:"maker"`
+}
+
+func newRequest(contentType, body string) *request.Request {
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "POST", Target: "/", HttpVersion: "1.1"}
+	if contentType != "" {
+		r.Headers.Set("Content-Type", contentType)
+	}
+	r.Body = []byte(body)
+	return r
+}
+
+func TestDecode(t *testing.T) {
+	var it item
+	require.NoError(t, Decode(newRequest("application/json; charset=utf-8", `{"name":"pen","price":3}`), &it))
+	assert.Equal(t, item{Name: "pen", Price: 3}, it)
+	require.NoError(t, Decode(newRequest("application/merge-patch+json", `{"name":"ink"}`), &it))
+	assert.Equal(t, "ink", it.Name)
+
+	for _, tc := range []struct {
+		contentType, body string
+		status            int
+		message           string
+	}{
+		{"text/plain", `{}`, 415, "Content-Type must be application/json"},
+		{"", `{}`, 415, "Content-Type must be application/json"},
+		{"application/json", ``, 400, "empty body"},
+		{"application/json", `{"name":`, 400, "truncated JSON"},
+		{"application/json", `{"name" "x"}`, 400, "invalid JSON at offset 9"},
+		{"application/json", `{"price":"3"}`, 400, `field "price" must be number, got string`},
+		{"application/json", `{"maker":{"country":1}}`, 400, `field "maker.country" must be string, got number`},
+		{"application/json", `{"color":"red"}`, 400, `unknown field "color"`},
+		{"application/json", `{"maker":{"zz":1}}`, 400, `unknown field "maker.zz"`},
+		{"application/json", `{"zz":{},"maker":{"zz":1}}`, 400, `unknown field "zz"`},
+		{"application/json", `{"MAKER":{"Country":"fr","zz":1}}`, 400, `unknown field "MAKER.zz"`},
+		{"application/json", `{} {}`, 400, "body must hold a single JSON value"},
+		{"application/json", `{"name":"` + strings.Repeat("x", 100) + `"}`, 413, "body larger than 64 bytes"},
+	} {
+		err := Decode(newRequest(tc.contentType, tc.body), &item{}, WithMaxBytes(64))
+		var httpErr *server.HTTPError
+		require.True(t, errors.As(err, &httpErr), tc.body)
+		assert.Equal(t, tc.status, httpErr.Status, tc.body)
+		assert.Equal(t, tc.message, httpErr.Message, tc.body)
+	}
+
+	// Test: Unknown fields allowed
+	require.NoError(t, Decode(newRequest("application/json", `{"color":"red"}`), &item{}, AllowUnknownFields()))
+}
+
+func respond(t *testing.T, accept string) (string, error) {
+	t.Helper()
+	r := newRequest("", "")
+	if accept != "" {
+		r.Headers.Set(Accept, accept)
+	}
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	err := Respond(w, r, response.StatusCreated, map[string]int{"id": 7})
+	if err != nil {
+		return "", err
+	}
+	require.NoError(t, w.Finish())
+	return buf.String(), nil
+}
+
+func TestRespond(t *testing.T) {
+	resp, err := respond(t, "")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 201 Created\r\n"))
+	assert.Contains(t, resp, "content-type: application/json\r\n")
+	assert.Contains(t, resp, "content-length: 9\r\n")
+	assert.Contains(t, resp, "vary: Accept\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n{\"id\":7}\n"))
+
+	resp, err = respond(t, "text/*;q=0.9, application/json;q=0.5")
+	require.NoError(t, err)
+	assert.Contains(t, resp, "content-type: text/plain; charset=utf-8\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nmap[id:7]\n"))
+
+	resp, err = respond(t, "*/*;q=0.8, application/json")
+	require.NoError(t, err)
+	assert.Contains(t, resp, "content-type: application/json\r\n")
+
+	_, err = respond(t, "image/png, application/json;q=0")
+	var httpErr *server.HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, response.StatusNotAcceptable, httpErr.Status)
+}
@@ -0,0 +1,311 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/auth"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const defaultSkew = time.Minute
+
+// Claims is the payload of a token.
+type Claims map[string]any
+
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the aud claim, which may be a string or an array.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var auds []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+// Time returns the NumericDate claim name, e.g. exp.
+func (c Claims) Time(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// FromRequest returns the claims of the token r was authenticated with,
+// nil if it went through no JWT middleware.
+func FromRequest(r *request.Request) Claims {
+	p := auth.FromRequest(r)
+	if p == nil || p.Scheme != "Bearer" {
+		return nil
+	}
+	return p.Claims
+}
+
+// Verifier checks tokens against a KeySet and the claims it expects.
+type Verifier struct {
+	keys     *KeySet
+	issuer   string
+	audience []string
+	skew     time.Duration
+	authOpts []auth.Option
+	now      func() time.Time
+}
+
+type Option func(*Verifier)
+
+// WithIssuer requires the iss claim to be issuer.
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim to contain one of audience.
+func WithAudience(audience ...string) Option {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// WithClockSkew sets how much exp and nbf may be off, to allow for clocks
+// that aren't in sync, defaults to a minute.
+func WithClockSkew(d time.Duration) Option {
+	return func(v *Verifier) {
+		v.skew = d
+	}
+}
+
+// WithRealm sets the realm named in challenges of the middleware.
+func WithRealm(realm string) Option {
+	return func(v *Verifier) {
+		v.authOpts = append(v.authOpts, auth.WithRealm(realm))
+	}
+}
+
+func NewVerifier(keys *KeySet, opts ...Option) *Verifier {
+	v := &Verifier{
+		keys: keys,
+		skew: defaultSkew,
+		now:  time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// New returns a middleware requiring a bearer JWT that verifies with one
+// of keys. The claims are attached to the request, see FromRequest, and
+// the subject becomes the name of the auth.Principal.
+func New(keys *KeySet, opts ...Option) server.Middleware {
+	v := NewVerifier(keys, opts...)
+	return auth.Bearer(func(r *request.Request, token string) (*auth.Principal, error) {
+		claims, err := v.Verify(token)
+		if err != nil {
+			return nil, err
+		}
+		return &auth.Principal{Name: claims.Subject(), Claims: claims}, nil
+	}, v.authOpts...)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verify checks the signature of a compact serialized token, RFC 7519,
+// then its exp, nbf, iss and aud claims, and returns its claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	keys := v.keys.find(h.Kid, h.Alg)
+	if len(keys) == 0 {
+		if !slices.Contains([]string{HS256, RS256, ES256, EdDSA}, h.Alg) {
+			return nil, ErrUnsupportedAlg
+		}
+		return nil, ErrUnknownKey
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	if !slices.ContainsFunc(keys, func(k Key) bool { return verify(k, signed, sig) }) {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil || claims == nil {
+		return nil, ErrMalformed
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validate(claims Claims) error {
+	now := v.now()
+	for _, name := range []string{"exp", "nbf"} {
+		if _, present := claims[name]; !present {
+			continue
+		}
+		t, ok := claims.Time(name)
+		switch {
+		case !ok:
+			return ErrMalformed
+		case name == "exp" && !now.Before(t.Add(v.skew)):
+			return ErrExpired
+		case name == "nbf" && now.Add(v.skew).Before(t):
+			return ErrNotYetValid
+		}
+	}
+	if v.issuer != "" && claims.Issuer() != v.issuer {
+		return ErrInvalidIssuer
+	}
+	if len(v.audience) > 0 && !slices.ContainsFunc(claims.Audience(), func(aud string) bool {
+		return slices.Contains(v.audience, aud)
+	}) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+func decodeJSON(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verify(k Key, signed, sig []byte) bool {
+	switch k.alg {
+	case HS256:
+		mac := hmac.New(sha256.New, k.Key.([]byte))
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case RS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.Key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		// the signature is r and s as 32 bytes each, RFC 7518 section 3.4
+		if len(sig) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(signed)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k.Key.(*ecdsa.PublicKey), digest[:], r, s)
+	case EdDSA:
+		return ed25519.Verify(k.Key.(ed25519.PublicKey), signed, sig)
+	}
+	return false
+}
+
+// Sign returns a token holding claims signed with key: a []byte secret
+// for HS256, an *rsa.PrivateKey, an *ecdsa.PrivateKey on P-256 or an
+// ed25519.PrivateKey. kid is put in the header unless empty.
+func Sign(claims Claims, kid string, key any) (string, error) {
+	h := header{Kid: kid, Typ: "JWT"}
+	switch k := key.(type) {
+	case []byte:
+		h.Alg = HS256
+	case *rsa.PrivateKey:
+		h.Alg = RS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrInvalidKey
+		}
+		h.Alg = ES256
+	case ed25519.PrivateKey:
+		h.Alg = EdDSA
+	default:
+		return "", ErrInvalidKey
+	}
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(nil, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		if err == nil {
+			sig = make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("no key for token")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
@@ -0,0 +1,233 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/auth"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+type signers struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newSigners(t *testing.T) signers {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return signers{rsaKey, ecKey, edKey}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwks publishes the public keys of s the way an identity provider would
+func (s signers) jwks() []byte {
+	ed := s.ed.Public().(ed25519.PublicKey)
+	return fmt.Appendf(nil, `{"keys": [
+		{"kty": "oct", "kid": "hs", "k": %q},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AA", "y": "AA"}
+	]}`,
+		b64(secret),
+		b64(s.rsa.N.Bytes()), b64(big.NewInt(int64(s.rsa.E)).Bytes()),
+		b64(s.ec.X.FillBytes(make([]byte, 32))), b64(s.ec.Y.FillBytes(make([]byte, 32))),
+		b64(ed),
+	)
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	s := newSigners(t)
+	keys, err := ParseJWKS(s.jwks())
+	require.NoError(t, err)
+	v := NewVerifier(keys)
+
+	signing := map[string]any{"hs": secret, "rs": s.rsa, "es": s.ec, "ed": s.ed}
+	for kid, key := range signing {
+		token, err := Sign(Claims{"sub": kid}, kid, key)
+		require.NoError(t, err)
+		claims, err := v.Verify(token)
+		require.NoError(t, err, kid)
+		assert.Equal(t, kid, claims.Subject())
+
+		// Test: Tampered payload
+		parts := strings.Split(token, ".")
+		parts[1] = b64([]byte(`{"sub":"admin"}`))
+		_, err = v.Verify(strings.Join(parts, "."))
+		assert.ErrorIs(t, err, ErrInvalidSignature, kid)
+	}
+
+	// Test: Without kid every key of the algorithm is tried
+	token, err := Sign(Claims{"sub": "x"}, "", s.ec)
+	require.NoError(t, err)
+	_, err = v.Verify(token)
+	assert.NoError(t, err)
+
+	// Test: Unknown kid, other key, unsupported algorithms
+	token, err = Sign(Claims{}, "nope", secret)
+	require.NoError(t, err)
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	token, err = Sign(Claims{}, "rs", other)
+	require.NoError(t, err)
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	none := b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"admin"}`)) + "."
+	_, err = v.Verify(none)
+	assert.ErrorIs(t, err, ErrUnsupportedAlg)
+
+	// Test: An HMAC token can't pass as signed with a public key
+	forged := b64([]byte(`{"alg":"HS256","kid":"rs"}`)) + "." + b64([]byte(`{}`)) + ".AAAA"
+	_, err = v.Verify(forged)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	for _, malformed := range []string{"", "a.b", "!!.e30.AAAA", "e30.e30.!!"} {
+		_, err = v.Verify(malformed)
+		assert.ErrorIs(t, err, ErrMalformed, malformed)
+	}
+}
+
+func TestClaims(t *testing.T) {
+	keys, err := NewKeySet(Key{ID: "k1", Key: secret})
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier(keys,
+		WithIssuer("https://issuer.example.com"),
+		WithAudience("orders", "billing"),
+		WithClockSkew(30*time.Second),
+	)
+	v.now = func() time.Time { return now }
+
+	valid := func() Claims {
+		return Claims{
+			"iss": "https://issuer.example.com",
+			"aud": []any{"billing", "other"},
+			"exp": float64(now.Add(time.Hour).Unix()),
+			"nbf": float64(now.Add(-time.Hour).Unix()),
+		}
+	}
+	cases := []struct {
+		name   string
+		change func(c Claims)
+		want   error
+	}{
+		{"valid", func(c Claims) {}, nil},
+		{"audience string", func(c Claims) { c["aud"] = "orders" }, nil},
+		{"expired within skew", func(c Claims) { c["exp"] = float64(now.Add(-20 * time.Second).Unix()) }, nil},
+		{"expired", func(c Claims) { c["exp"] = float64(now.Add(-time.Minute).Unix()) }, ErrExpired},
+		{"exp not a number", func(c Claims) { c["exp"] = "tomorrow" }, ErrMalformed},
+		{"not yet valid within skew", func(c Claims) { c["nbf"] = float64(now.Add(20 * time.Second).Unix()) }, nil},
+		{"not yet valid", func(c Claims) { c["nbf"] = float64(now.Add(time.Minute).Unix()) }, ErrNotYetValid},
+		{"wrong issuer", func(c Claims) { c["iss"] = "https://evil.example.com" }, ErrInvalidIssuer},
+		{"no audience", func(c Claims) { delete(c, "aud") }, ErrInvalidAudience},
+		{"wrong audience", func(c Claims) { c["aud"] = "other" }, ErrInvalidAudience},
+	}
+	for _, c := range cases {
+		claims := valid()
+		c.change(claims)
+		token, err := Sign(claims, "k1", secret)
+		require.NoError(t, err)
+		_, err = v.Verify(token)
+		if c.want == nil {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.ErrorIs(t, err, c.want, c.name)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	keys, err := NewKeySet(Key{Key: secret})
+	require.NoError(t, err)
+	mw := New(keys, WithRealm("api"))
+
+	var claims Claims
+	var principal *auth.Principal
+	h := mw(func(w *response.Writer, r *request.Request) error {
+		claims = FromRequest(r)
+		principal = auth.FromRequest(r)
+		return nil
+	})
+	call := func(token string) error {
+		r := request.NewRequest()
+		r.RequestLine = &request.RequestLine{Method: "GET", Target: "/", HttpVersion: "1.1"}
+		if token != "" {
+			r.Headers.Set(auth.Authorization, "Bearer "+token)
+		}
+		return h(response.NewResponseWriter(nil), r)
+	}
+
+	token, err := Sign(Claims{"sub": "user-1", "scope": "read"}, "", secret)
+	require.NoError(t, err)
+	require.NoError(t, call(token))
+	assert.Equal(t, "user-1", principal.Name)
+	assert.Equal(t, "Bearer", principal.Scheme)
+	assert.Equal(t, "read", claims["scope"])
+
+	// Test: Failures are 401 challenges
+	expired, err := Sign(Claims{"exp": float64(time.Now().Add(-time.Hour).Unix())}, "", secret)
+	require.NoError(t, err)
+	for token, challenge := range map[string]string{
+		"":      `Bearer realm="api"`,
+		expired: `Bearer realm="api", error="invalid_token", error_description="token expired"`,
+	} {
+		err := call(token)
+		var httpErr *server.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, response.StatusUnauthorized, httpErr.Status)
+		assert.Equal(t, challenge, httpErr.Headers.GetTest(auth.WWWAuthenticate))
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	s := newSigners(t)
+
+	_, err := NewKeySet(Key{ID: "empty", Key: []byte{}})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewKeySet(Key{ID: "p384", Key: &p384.PublicKey})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = NewKeySet(Key{ID: "private", Key: s.rsa})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// Test: A JWKS key whose alg doesn't fit its type
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"x","alg":"RS256","k":"c2VjcmV0"}]}`))
+	assert.ErrorIs(t, err, ErrUnsupportedAlg)
+
+	// Test: A point off the curve
+	_, err = ParseJWKS(fmt.Appendf(nil, `{"keys":[{"kty":"EC","crv":"P-256","x":%q,"y":%q}]}`,
+		b64(make([]byte, 32)), b64(make([]byte, 32))))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
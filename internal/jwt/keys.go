@@ -0,0 +1,211 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// The signature algorithms supported, RFC 7518 and RFC 8037.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// Key is a key tokens may be verified with.
+type Key struct {
+	// ID matches the kid of token headers, tokens without kid are tried
+	// against every key of their algorithm.
+	ID string
+	// Key is a []byte HMAC secret, an *rsa.PublicKey, an *ecdsa.PublicKey
+	// on P-256 or an ed25519.PublicKey.
+	Key any
+
+	alg string
+}
+
+// KeySet is the keys a Verifier accepts.
+type KeySet struct {
+	keys []Key
+}
+
+// NewKeySet returns a set of statically configured keys.
+func NewKeySet(keys ...Key) (*KeySet, error) {
+	ks := &KeySet{}
+	for _, k := range keys {
+		alg, err := algorithm(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.ID, err)
+		}
+		k.alg = alg
+		ks.keys = append(ks.keys, k)
+	}
+	return ks, nil
+}
+
+// algorithm returns the algorithm a verification key is for
+func algorithm(key any) (string, error) {
+	switch k := key.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return "", ErrInvalidKey
+		}
+		return HS256, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return "", ErrInvalidKey
+		}
+		return RS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrInvalidKey
+		}
+		return ES256, nil
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return "", ErrInvalidKey
+		}
+		return EdDSA, nil
+	}
+	return "", ErrInvalidKey
+}
+
+// find returns the keys a token with kid and alg may have been signed with
+func (ks *KeySet) find(kid, alg string) []Key {
+	var keys []Key
+	for _, k := range ks.keys {
+		if k.alg == alg && (kid == "" || k.ID == kid) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// LoadJWKS reads a JSON Web Key Set file, RFC 7517.
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses a JSON Web Key Set. Keys of other types than oct, RSA,
+// EC P-256 and OKP Ed25519, or not meant for signatures, are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	var keys []Key
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		key, err := j.key()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", j.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		if alg, _ := algorithm(key); j.Alg != "" && j.Alg != alg {
+			return nil, fmt.Errorf("key %q: %w", j.Kid, ErrUnsupportedAlg)
+		}
+		keys = append(keys, Key{ID: j.Kid, Key: key})
+	}
+	return NewKeySet(keys...)
+}
+
+// key decodes the public key of j, nil for unsupported types
+func (j jwk) key() (any, error) {
+	switch {
+	case j.Kty == "oct":
+		return decodeField(j.K)
+	case j.Kty == "RSA":
+		n, err := decodeInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(j.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, ErrInvalidKey
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, err := decodeField(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeField(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrInvalidKey
+		}
+		// ecdh checks the point is on the curve
+		point := append([]byte{4}, append(x, y...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, ErrInvalidKey
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := decodeField(j.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeField(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrInvalidKey
+	}
+	return b, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := decodeField(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+var (
+	ErrInvalidKey     = errors.New("invalid or unsupported key")
+	ErrUnsupportedAlg = errors.New("unsupported signature algorithm")
+)
@@ -0,0 +1,277 @@
+package negotiate
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	Accept         = "Accept"
+	AcceptCharset  = "Accept-Charset"
+	AcceptEncoding = "Accept-Encoding"
+	AcceptLanguage = "Accept-Language"
+)
+
+// MediaRange is one element of an Accept header, e.g. text/html;level=1.
+type MediaRange struct {
+	Type    string
+	Subtype string
+	// Params are the media type parameters, the q-value excluded.
+	Params map[string]string
+	Q      float64
+}
+
+// Item is one element of an Accept-Charset, -Encoding or -Language header.
+type Item struct {
+	Value string
+	Q     float64
+}
+
+// ParseMediaRanges parses an Accept header. Types and parameter names are
+// lowercased, malformed elements are skipped.
+func ParseMediaRanges(header string) []MediaRange {
+	var ranges []MediaRange
+	for _, elem := range splitList(header) {
+		params := strings.Split(elem, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+		mr := MediaRange{Type: typ, Subtype: subtype, Q: 1}
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "q" {
+				// the q-value ends the media type parameters
+				mr.Q = parseQ(val)
+				break
+			}
+			if mr.Params == nil {
+				mr.Params = make(map[string]string)
+			}
+			mr.Params[key] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// ParseItems parses a quality list such as Accept-Encoding, values are
+// lowercased.
+func ParseItems(header string) []Item {
+	var items []Item
+	for _, elem := range splitList(header) {
+		params := strings.Split(elem, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		item := Item{Value: value, Q: 1}
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				item.Q = parseQ(val)
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func splitList(header string) []string {
+	var elems []string
+	for _, elem := range strings.Split(header, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// parseQ parses a qvalue, anything out of range counts as 0
+func parseQ(s string) float64 {
+	q, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0
+	}
+	return q
+}
+
+// BestMediaType returns the offer the Accept header accept ranks highest,
+// offers may carry parameters like "text/html; level=1". Each offer gets
+// the q-value of the most specific range matching it, RFC 9110 section
+// 12.5.1. Ties go to the earlier offer, an empty accept takes the first.
+func BestMediaType(accept string, offers ...string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	ranges := ParseMediaRanges(accept)
+	return best(offers, func(offer string) float64 {
+		o := parseOffer(offer)
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			s, ok := mr.match(o)
+			if ok && s > specificity {
+				q, specificity = mr.Q, s
+			}
+		}
+		return q
+	})
+}
+
+// match reports whether mr covers the offer and how specifically:
+// */* < type/* < type/subtype < type/subtype;params.
+func (mr MediaRange) match(o MediaRange) (int, bool) {
+	switch {
+	case mr.Type == "*":
+		return 0, true
+	case mr.Type != o.Type:
+		return 0, false
+	case mr.Subtype == "*":
+		return 1, true
+	case mr.Subtype != o.Subtype:
+		return 0, false
+	}
+	for key, val := range mr.Params {
+		if !strings.EqualFold(o.Params[key], val) {
+			return 0, false
+		}
+	}
+	return 2 + len(mr.Params), true
+}
+
+func parseOffer(offer string) MediaRange {
+	ranges := ParseMediaRanges(offer)
+	if len(ranges) == 0 {
+		return MediaRange{}
+	}
+	return ranges[0]
+}
+
+// BestEncoding returns the content coding in offers the Accept-Encoding
+// header accept ranks highest. "identity" is acceptable unless excluded
+// explicitly or through "*;q=0", RFC 9110 section 12.5.3.
+func BestEncoding(accept string, offers ...string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	items := ParseItems(accept)
+	return best(offers, func(offer string) float64 {
+		q, matched := itemQ(items, offer, false)
+		if !matched && strings.EqualFold(offer, "identity") {
+			return 1
+		}
+		return q
+	})
+}
+
+// BestCharset returns the charset in offers the Accept-Charset header
+// accept ranks highest.
+func BestCharset(accept string, offers ...string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	items := ParseItems(accept)
+	return best(offers, func(offer string) float64 {
+		q, _ := itemQ(items, offer, false)
+		return q
+	})
+}
+
+// BestLanguage returns the language tag in offers the Accept-Language
+// header accept ranks highest. A range matches a tag equal to it or
+// starting with it followed by "-", the longest matching range counts,
+// RFC 4647 section 3.3.1.
+func BestLanguage(accept string, offers ...string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	items := ParseItems(accept)
+	return best(offers, func(offer string) float64 {
+		q, _ := itemQ(items, offer, true)
+		return q
+	})
+}
+
+// itemQ returns the q-value of the most specific item matching offer,
+// "*" being the least specific. matched is false when no item matched.
+func itemQ(items []Item, offer string, prefix bool) (q float64, matched bool) {
+	offer = strings.ToLower(offer)
+	specificity := -1
+	for _, item := range items {
+		s := -1
+		switch {
+		case item.Value == "*":
+			s = 0
+		case item.Value == offer || prefix && strings.HasPrefix(offer, item.Value+"-"):
+			s = len(item.Value)
+		}
+		if s > specificity {
+			q, specificity = item.Q, s
+		}
+	}
+	return q, specificity >= 0
+}
+
+// best returns the offer with the highest q-value above 0, the earlier
+// offer wins a tie.
+func best(offers []string, quality func(offer string) float64) (string, bool) {
+	bestOffer, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(offer); q > bestQ {
+			bestOffer, bestQ = offer, q
+		}
+	}
+	return bestOffer, bestQ > 0
+}
+
+func first(offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	return offers[0], true
+}
+
+// MediaType negotiates the response media type for r among offers. When
+// none is acceptable the error is a 406 *server.HTTPError listing offers.
+func MediaType(r *request.Request, offers ...string) (string, error) {
+	accept, _ := r.Headers.Get(Accept)
+	offer, ok := BestMediaType(accept, offers...)
+	return offer, notAcceptable(ok, offers)
+}
+
+// Encoding is MediaType for the content coding.
+func Encoding(r *request.Request, offers ...string) (string, error) {
+	accept, ok := r.Headers.Get(AcceptEncoding)
+	if ok && strings.TrimSpace(accept) == "" {
+		// an empty Accept-Encoding asks for no coding at all
+		accept = "identity"
+	}
+	offer, ok := BestEncoding(accept, offers...)
+	return offer, notAcceptable(ok, offers)
+}
+
+// Charset is MediaType for the charset.
+func Charset(r *request.Request, offers ...string) (string, error) {
+	accept, _ := r.Headers.Get(AcceptCharset)
+	offer, ok := BestCharset(accept, offers...)
+	return offer, notAcceptable(ok, offers)
+}
+
+// Language is MediaType for the language.
+func Language(r *request.Request, offers ...string) (string, error) {
+	accept, _ := r.Headers.Get(AcceptLanguage)
+	offer, ok := BestLanguage(accept, offers...)
+	return offer, notAcceptable(ok, offers)
+}
+
+func notAcceptable(ok bool, offers []string) error {
+	if ok {
+		return nil
+	}
+	return server.NewError(response.StatusNotAcceptable, "available: "+strings.Join(offers, ", "))
+}
@@ -0,0 +1,100 @@
+package negotiate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/server"
+)
+
+func TestParseMediaRanges(t *testing.T) {
+	ranges := ParseMediaRanges(`text/html;level=1;q=0.7, TEXT/*;q=0.3, */*, bad, */html, application/json;q=x`)
+	require.Len(t, ranges, 4)
+	assert.Equal(t, MediaRange{Type: "text", Subtype: "html", Params: map[string]string{"level": "1"}, Q: 0.7}, ranges[0])
+	assert.Equal(t, MediaRange{Type: "text", Subtype: "*", Q: 0.3}, ranges[1])
+	assert.Equal(t, MediaRange{Type: "*", Subtype: "*", Q: 1}, ranges[2])
+	assert.Equal(t, 0.0, ranges[3].Q)
+}
+
+func TestBestMediaType(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		offers []string
+		want   string
+		ok     bool
+	}{
+		{"", []string{"application/json", "text/plain"}, "application/json", true},
+		{"text/plain", []string{"application/json", "text/plain"}, "text/plain", true},
+		{"text/*;q=0.5, application/json;q=0.4", []string{"application/json", "text/plain"}, "text/plain", true},
+		// ties go to the server's order
+		{"*/*", []string{"text/html", "application/json"}, "text/html", true},
+		// the more specific range overrides the wildcard
+		{"*/*, text/html;q=0", []string{"text/html", "application/json"}, "application/json", true},
+		// RFC 9110 section 12.5.1 example
+		{"text/*;q=0.3, text/plain;q=0.7, text/plain;format=flowed, text/plain;format=fixed;q=0.4, */*;q=0.5",
+			[]string{"text/plain;format=fixed", "text/html", "text/plain;format=flowed"}, "text/plain;format=flowed", true},
+		{"text/*;q=0.3, text/plain;q=0.7, */*;q=0.5", []string{"text/html", "image/png"}, "image/png", true},
+		{"image/*", []string{"application/json", "text/plain"}, "", false},
+		{"application/json;q=0", []string{"application/json"}, "", false},
+	} {
+		got, ok := BestMediaType(tc.accept, tc.offers...)
+		assert.Equal(t, tc.want, got, tc.accept)
+		assert.Equal(t, tc.ok, ok, tc.accept)
+	}
+}
+
+func TestBestEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		offers []string
+		want   string
+		ok     bool
+	}{
+		{"gzip, deflate", []string{"br", "deflate", "gzip"}, "deflate", true},
+		{"gzip;q=0.5, deflate;q=0.8", []string{"gzip", "deflate"}, "deflate", true},
+		{"*;q=0.2, gzip;q=0", []string{"gzip", "br"}, "br", true},
+		{"br", []string{"gzip", "identity"}, "identity", true},
+		{"br, identity;q=0", []string{"gzip", "identity"}, "", false},
+		{"br, *;q=0", []string{"gzip", "identity"}, "", false},
+		{"GZIP", []string{"gzip"}, "gzip", true},
+	} {
+		got, ok := BestEncoding(tc.accept, tc.offers...)
+		assert.Equal(t, tc.want, got, tc.accept)
+		assert.Equal(t, tc.ok, ok, tc.accept)
+	}
+}
+
+func TestBestLanguageAndCharset(t *testing.T) {
+	got, ok := BestLanguage("da, en-gb;q=0.8, en;q=0.7", "en-US", "en-GB", "fr")
+	assert.True(t, ok)
+	assert.Equal(t, "en-GB", got)
+	got, _ = BestLanguage("fr;q=0.5, *;q=0.6", "fr-CA", "de")
+	assert.Equal(t, "de", got)
+	_, ok = BestLanguage("en", "english", "fr")
+	assert.False(t, ok)
+
+	got, ok = BestCharset("iso-8859-5, utf-8;q=0.8", "utf-8", "iso-8859-5")
+	assert.True(t, ok)
+	assert.Equal(t, "iso-8859-5", got)
+}
+
+func TestNotAcceptable(t *testing.T) {
+	r := request.NewRequest()
+	r.Headers.Set(Accept, "image/png")
+	_, err := MediaType(r, "application/json", "text/plain")
+	var httpErr *server.HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, 406, httpErr.Status)
+	assert.Equal(t, "available: application/json, text/plain", httpErr.Message)
+
+	// Test: Empty Accept-Encoding only takes identity
+	r.Headers.Set(AcceptEncoding, "")
+	got, err := Encoding(r, "gzip", "identity")
+	require.NoError(t, err)
+	assert.Equal(t, "identity", got)
+	_, err = Encoding(r, "gzip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	RetryAfter         = "Retry-After"
+	RateLimitLimit     = "RateLimit-Limit"
+	RateLimitRemaining = "RateLimit-Remaining"
+	RateLimitReset     = "RateLimit-Reset"
+)
+
+const defaultIdleTTL = 10 * time.Minute
+
+// KeyFunc picks the bucket a request is counted against.
+// Requests with an empty key share one bucket.
+type KeyFunc func(r *request.Request) string
+
+// ByRemoteIP keys requests by the client IP, ignoring the port.
+func ByRemoteIP(r *request.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByHeader keys requests by the value of the header name, e.g. an API key.
+func ByHeader(name string) KeyFunc {
+	return func(r *request.Request) string {
+		val, _ := r.Headers.Get(name)
+		return val
+	}
+}
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token is available.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store holds the token buckets.
+type Store interface {
+	Take(key string, rate float64, burst int, now time.Time) Result
+}
+
+type limiter struct {
+	rate  float64
+	burst int
+	key   KeyFunc
+	store Store
+	now   func() time.Time
+}
+
+type Option func(*limiter)
+
+// WithKey sets how requests are keyed, defaults to ByRemoteIP.
+func WithKey(key KeyFunc) Option {
+	return func(l *limiter) {
+		l.key = key
+	}
+}
+
+// WithStore sets where buckets are kept, defaults to a MemoryStore that
+// forgets keys idle for 10 minutes.
+func WithStore(store Store) Option {
+	return func(l *limiter) {
+		l.store = store
+	}
+}
+
+// New returns a middleware allowing each key rate requests per second on
+// average with bursts of up to burst requests. Requests over the limit get
+// a 429 Too Many Requests and never reach the handler. It panics unless
+// rate is positive and burst at least 1.
+func New(rate float64, burst int, opts ...Option) server.Middleware {
+	if !(rate > 0) || burst < 1 {
+		panic("ratelimit: rate must be positive and burst at least 1")
+	}
+	l := &limiter{
+		rate:  rate,
+		burst: burst,
+		key:   ByRemoteIP,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.store == nil {
+		l.store = NewMemoryStore(defaultIdleTTL)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			res := l.store.Take(l.key(r), l.rate, l.burst, l.now())
+
+			h := w.Headers()
+			h.Set(RateLimitLimit, strconv.Itoa(l.burst))
+			h.Set(RateLimitRemaining, strconv.Itoa(res.Remaining))
+			h.Set(RateLimitReset, seconds(res.Reset))
+			if res.Allowed {
+				return next(w, r)
+			}
+
+			h.Set(RetryAfter, seconds(res.RetryAfter))
+			if err := w.WriteStatus(response.StatusTooManyRequests); err != nil {
+				return err
+			}
+			_, err := w.Write([]byte("Too many requests\n"))
+			return err
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers expect.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps buckets in memory. Buckets not touched for idleTTL are
+// evicted, an evicted bucket would have been full again anyway as long as
+// idleTTL is longer than burst/rate.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	idleTTL   time.Duration
+	lastSweep time.Time
+}
+
+func NewMemoryStore(idleTTL time.Duration) *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		idleTTL: idleTTL,
+	}
+}
+
+func (s *MemoryStore) Take(key string, rate float64, burst int, now time.Time) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= s.idleTTL {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = min(float64(burst), b.tokens+elapsed*rate)
+	b.last = now
+
+	res := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second))
+	return res
+}
+
+// Len returns the number of buckets currently kept.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= s.idleTTL {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
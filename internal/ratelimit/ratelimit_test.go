@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+func ok(w *response.Writer, r *request.Request) error {
+	_, err := w.Write([]byte("ok"))
+	return err
+}
+
+func serve(t *testing.T, h server.Handler, r *request.Request) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(t, h(w, r))
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func newRequest(remoteAddr string) *request.Request {
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "GET", Target: "/", HttpVersion: "1.1"}
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	mw := New(1, 2, func(l *limiter) {
+		l.now = func() time.Time { return now }
+	})
+	h := mw(ok)
+
+	resp := serve(t, h, newRequest("10.0.0.1:1234"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "ratelimit-limit: 2\r\n")
+	assert.Contains(t, resp, "ratelimit-remaining: 1\r\n")
+	assert.Contains(t, resp, "ratelimit-reset: 1\r\n")
+
+	resp = serve(t, h, newRequest("10.0.0.1:4321"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "ratelimit-remaining: 0\r\n")
+
+	// Test: Bucket is empty
+	resp = serve(t, h, newRequest("10.0.0.1:1234"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 429 Too Many Requests\r\n"))
+	assert.Contains(t, resp, "retry-after: 1\r\n")
+	assert.NotContains(t, resp, "ok")
+
+	// Test: Other clients have their own bucket
+	resp = serve(t, h, newRequest("10.0.0.2:1234"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Tokens refill over time
+	now = now.Add(time.Second)
+	resp = serve(t, h, newRequest("10.0.0.1:1234"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Limits that never refill or never allow
+	assert.Panics(t, func() { New(0, 2) })
+	assert.Panics(t, func() { New(-1, 2) })
+	assert.Panics(t, func() { New(math.NaN(), 2) })
+	assert.Panics(t, func() { New(1, 0) })
+}
+
+func TestByHeader(t *testing.T) {
+	h := New(1, 1, WithKey(ByHeader("X-Api-Key")))(ok)
+
+	r := newRequest("10.0.0.1:1234")
+	r.Headers.Set("X-Api-Key", "a")
+	assert.True(t, strings.HasPrefix(serve(t, h, r), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasPrefix(serve(t, h, r), "HTTP/1.1 429 Too Many Requests\r\n"))
+
+	r = newRequest("10.0.0.1:1234")
+	r.Headers.Set("X-Api-Key", "b")
+	assert.True(t, strings.HasPrefix(serve(t, h, r), "HTTP/1.1 200 OK\r\n"))
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	s := NewMemoryStore(time.Minute)
+	now := time.Unix(0, 0)
+	s.Take("a", 1, 1, now)
+	s.Take("b", 1, 1, now.Add(30*time.Second))
+	assert.Equal(t, 2, s.Len())
+
+	s.Take("c", 1, 1, now.Add(time.Minute))
+	assert.Equal(t, 2, s.Len())
+
+	s.Take("c", 1, 1, now.Add(3*time.Minute))
+	assert.Equal(t, 1, s.Len())
+}
@@ -0,0 +1,283 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/yanshuy/http/internal/headers"
+)
+
+const (
+	FormURLEncoded = "application/x-www-form-urlencoded"
+	MultipartForm  = "multipart/form-data"
+
+	// maxFormSize bounds url-encoded bodies and multipart values
+	maxFormSize  = 10 << 20
+	maxFormParts = 1000
+)
+
+// formState caches the parsed forms. It is shared by the shallow copies
+// WithContext makes, so a form is parsed once.
+type formState struct {
+	query     url.Values
+	form      url.Values
+	postForm  url.Values
+	multipart *Multipart
+	parsed    bool
+	parseErr  error
+	streamed  bool
+}
+
+func (r *Request) forms() *formState {
+	if r.formState == nil {
+		r.formState = &formState{}
+	}
+	return r.formState
+}
+
+// Query returns the parameters of the query string of the target.
+func (r *Request) Query() url.Values {
+	fs := r.forms()
+	if fs.query == nil {
+		fs.query = url.Values{}
+		if r.RequestLine != nil {
+			if _, query, ok := strings.Cut(r.Target, "?"); ok {
+				fs.query, _ = url.ParseQuery(query)
+			}
+		}
+	}
+	return fs.query
+}
+
+// ParseForm parses an url-encoded or multipart body. It is called by the
+// accessors below and only does work once. The body is already in memory,
+// bounded by MaxBodySize, so uploaded files are slices of r.Body rather
+// than copies.
+func (r *Request) ParseForm() error {
+	fs := r.forms()
+	if fs.parsed {
+		return fs.parseErr
+	}
+	if fs.streamed {
+		return ErrBodyStreamed
+	}
+	fs.parsed = true
+	fs.postForm = url.Values{}
+	fs.parseErr = r.parseBody(fs)
+
+	fs.form = url.Values{}
+	for k, vs := range fs.postForm {
+		fs.form[k] = append(fs.form[k], vs...)
+	}
+	for k, vs := range r.Query() {
+		fs.form[k] = append(fs.form[k], vs...)
+	}
+	return fs.parseErr
+}
+
+func (r *Request) parseBody(fs *formState) error {
+	if r.RequestLine == nil || (r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH") {
+		return nil
+	}
+	mediaType, params, err := r.contentType()
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case FormURLEncoded:
+		if len(r.Body) > maxFormSize {
+			return ErrFormTooLarge
+		}
+		fs.postForm, err = url.ParseQuery(string(r.Body))
+		return err
+	case MultipartForm:
+		fs.multipart, err = readMultipart(r.Body, params["boundary"])
+		if err != nil {
+			return err
+		}
+		for k, vs := range fs.multipart.Value {
+			fs.postForm[k] = append(fs.postForm[k], vs...)
+		}
+	}
+	return nil
+}
+
+func (r *Request) contentType() (string, map[string]string, error) {
+	ct, ok := r.Headers.Get("Content-Type")
+	if !ok {
+		return "", nil, nil
+	}
+	return mime.ParseMediaType(ct)
+}
+
+// Form returns the body form merged with the query parameters, body
+// values first.
+func (r *Request) Form() (url.Values, error) {
+	err := r.ParseForm()
+	return r.forms().form, err
+}
+
+// PostForm returns the body form only.
+func (r *Request) PostForm() (url.Values, error) {
+	err := r.ParseForm()
+	return r.forms().postForm, err
+}
+
+// MultipartForm returns the parsed multipart body, nil if the body isn't
+// multipart.
+func (r *Request) MultipartForm() (*Multipart, error) {
+	err := r.ParseForm()
+	return r.forms().multipart, err
+}
+
+// FormValue returns the first value of key in Form, parse errors are
+// ignored.
+func (r *Request) FormValue(key string) string {
+	form, _ := r.Form()
+	return form.Get(key)
+}
+
+// PostFormValue returns the first value of key in PostForm, parse errors
+// are ignored.
+func (r *Request) PostFormValue(key string) string {
+	form, _ := r.PostForm()
+	return form.Get(key)
+}
+
+// FormFile returns the first file uploaded as key.
+func (r *Request) FormFile(key string) (*FileHeader, error) {
+	m, err := r.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || len(m.File[key]) == 0 {
+		return nil, ErrMissingFile
+	}
+	return m.File[key][0], nil
+}
+
+// MultipartReader streams the parts of a multipart/form-data body instead
+// of parsing it as a whole, the form accessors can't be used after.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+	fs := r.forms()
+	if fs.parsed {
+		return nil, ErrBodyStreamed
+	}
+	mediaType, params, err := r.contentType()
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != MultipartForm {
+		return nil, ErrNotMultipart
+	}
+	fs.streamed = true
+	return NewMultipartReader(bytes.NewReader(r.Body), params["boundary"])
+}
+
+// Multipart is a parsed multipart/form-data body.
+type Multipart struct {
+	Value url.Values
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes an uploaded file.
+type FileHeader struct {
+	Filename string
+	Headers  headers.Headers
+	Size     int64
+
+	// content is a slice of the request body
+	content []byte
+}
+
+// File is the content of an uploaded file.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+func (fh *FileHeader) Open() (File, error) {
+	return nopCloser{bytes.NewReader(fh.content)}, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func readMultipart(body []byte, boundary string) (*Multipart, error) {
+	src := bytes.NewReader(body)
+	mr, err := NewMultipartReader(src, boundary)
+	if err != nil {
+		return nil, err
+	}
+	// offset is how far into body mr has read
+	offset := func() int64 {
+		return int64(len(body)-src.Len()) - int64(mr.br.Buffered())
+	}
+
+	m := &Multipart{
+		Value: url.Values{},
+		File:  make(map[string][]*FileHeader),
+	}
+	maxValueBytes := int64(maxFormSize)
+	for parts := 0; ; parts++ {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parts == maxFormParts {
+			return nil, ErrFormTooLarge
+		}
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		filename := p.FileName()
+		if filename == "" {
+			var b bytes.Buffer
+			n, err := io.CopyN(&b, p, maxValueBytes+1)
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			if n > maxValueBytes {
+				return nil, ErrFormTooLarge
+			}
+			maxValueBytes -= n
+			m.Value.Add(name, b.String())
+			continue
+		}
+
+		start := offset()
+		n, err := io.Copy(io.Discard, p)
+		if err != nil {
+			return nil, err
+		}
+		m.File[name] = append(m.File[name], &FileHeader{
+			Filename: filename,
+			Headers:  p.Headers,
+			Size:     n,
+			content:  body[start : start+n : start+n],
+		})
+	}
+}
+
+var (
+	ErrFormTooLarge = errors.New("form too large")
+	ErrMissingFile  = errors.New("no such file in form")
+	ErrNotMultipart = errors.New("request body isn't multipart/form-data")
+	ErrBodyStreamed = errors.New("body already read as multipart stream")
+)
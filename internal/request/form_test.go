@@ -0,0 +1,148 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFormRequest(method, target, contentType, body string) *Request {
+	r := NewRequest()
+	r.RequestLine = &RequestLine{Method: method, Target: target, HttpVersion: "1.1"}
+	if contentType != "" {
+		r.Headers.Set("Content-Type", contentType)
+	}
+	r.Body = []byte(body)
+	return r
+}
+
+func TestURLEncodedForm(t *testing.T) {
+	r := newFormRequest("POST", "/submit?a=query&q=1", FormURLEncoded, "a=body&b=x+y&b=%21")
+
+	assert.Equal(t, "body", r.FormValue("a"))
+	assert.Equal(t, "1", r.FormValue("q"))
+	assert.Equal(t, "", r.PostFormValue("q"))
+	form, err := r.Form()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"body", "query"}, form["a"])
+	assert.Equal(t, []string{"x y", "!"}, form["b"])
+
+	// Test: Copies share the parsed form
+	r2 := r.WithContext(r.Context())
+	assert.Equal(t, "body", r2.FormValue("a"))
+
+	// Test: GET bodies aren't forms
+	r = newFormRequest("GET", "/?a=1", FormURLEncoded, "a=2")
+	assert.Equal(t, "1", r.FormValue("a"))
+
+	// Test: Malformed body
+	r = newFormRequest("POST", "/", FormURLEncoded, "a=%zz")
+	_, err = r.Form()
+	assert.Error(t, err)
+}
+
+const multipartBody = "preamble to ignore\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"hello\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"upload\"; filename=\"../../etc/a.txt\"\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"line one\r\n--not the boundary\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"empty\"\r\n" +
+	"\r\n" +
+	"\r\n" +
+	"--XyZ--\r\n" +
+	"epilogue"
+
+func TestMultipartForm(t *testing.T) {
+	r := newFormRequest("POST", "/upload", `multipart/form-data; boundary=XyZ`, multipartBody)
+
+	assert.Equal(t, "hello", r.FormValue("title"))
+	assert.Equal(t, "", r.FormValue("empty"))
+	fh, err := r.FormFile("upload")
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt", fh.Filename)
+	ct, _ := fh.Headers.Get("Content-Type")
+	assert.Equal(t, "text/plain", ct)
+	assert.Equal(t, int64(len("line one\r\n--not the boundary")), fh.Size)
+
+	f, err := fh.Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "line one\r\n--not the boundary", string(data))
+	require.NoError(t, f.Close())
+
+	_, err = r.FormFile("missing")
+	assert.Equal(t, ErrMissingFile, err)
+
+	// Test: Streaming after parsing is refused
+	_, err = r.MultipartReader()
+	assert.Equal(t, ErrBodyStreamed, err)
+}
+
+func TestMultipartFilesShareBody(t *testing.T) {
+	r := newFormRequest("POST", "/upload", `multipart/form-data; boundary=XyZ`, multipartBody)
+	fh, err := r.FormFile("upload")
+	require.NoError(t, err)
+
+	start := strings.Index(multipartBody, "line one")
+	require.NotEmpty(t, fh.content)
+	assert.Same(t, &r.Body[start], &fh.content[0])
+	assert.Equal(t, len(fh.content), cap(fh.content))
+}
+
+func TestMultipartReader(t *testing.T) {
+	r := newFormRequest("POST", "/upload", `multipart/form-data; boundary="XyZ"`, multipartBody)
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+
+	var names []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, p.FormName())
+		if p.FormName() == "title" {
+			// read in tiny pieces to cross the buffer edges
+			buf := make([]byte, 2)
+			var got strings.Builder
+			for {
+				n, err := p.Read(buf)
+				got.Write(buf[:n])
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+			}
+			assert.Equal(t, "hello", got.String())
+		}
+	}
+	assert.Equal(t, []string{"title", "upload", "empty"}, names)
+
+	// Test: Bad boundaries and bodies
+	_, err = NewMultipartReader(strings.NewReader(""), "bad\x00boundary")
+	assert.Equal(t, ErrInvalidBoundary, err)
+	_, err = NewMultipartReader(strings.NewReader(""), strings.Repeat("b", 71))
+	assert.Equal(t, ErrInvalidBoundary, err)
+
+	mr, err = NewMultipartReader(strings.NewReader("--XyZ\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\ntruncated"), "XyZ")
+	require.NoError(t, err)
+	p, err := mr.NextPart()
+	require.NoError(t, err)
+	_, err = io.ReadAll(p)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	r = newFormRequest("POST", "/", "text/plain", "")
+	_, err = r.MultipartReader()
+	assert.Equal(t, ErrNotMultipart, err)
+}
@@ -0,0 +1,230 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"path/filepath"
+
+	"github.com/yanshuy/http/internal/headers"
+)
+
+const (
+	maxPartHeaderBytes = 16 << 10
+	maxBoundaryLen     = 70
+)
+
+// MultipartReader streams the parts of a multipart body one at a time.
+type MultipartReader struct {
+	br             *bufio.Reader
+	dashBoundary   []byte // "--boundary"
+	nlDashBoundary []byte // "\r\n--boundary"
+	current        *Part
+	started        bool
+	done           bool
+}
+
+// NewMultipartReader reads parts separated by boundary from r.
+func NewMultipartReader(r io.Reader, boundary string) (*MultipartReader, error) {
+	if !validBoundary(boundary) {
+		return nil, ErrInvalidBoundary
+	}
+	return &MultipartReader{
+		br:             bufio.NewReaderSize(r, 4096+len(boundary)),
+		dashBoundary:   []byte("--" + boundary),
+		nlDashBoundary: []byte("\r\n--" + boundary),
+	}, nil
+}
+
+// validBoundary checks boundary against RFC 2046 section 5.1.1
+func validBoundary(boundary string) bool {
+	if boundary == "" || len(boundary) > maxBoundaryLen || boundary[len(boundary)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(boundary); i++ {
+		c := boundary[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case bytes.IndexByte([]byte("'()+_,-./:=? "), c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NextPart returns the next part, the rest of the previous part is
+// skipped. It returns io.EOF after the last part.
+func (mr *MultipartReader) NextPart() (*Part, error) {
+	if mr.done {
+		return nil, io.EOF
+	}
+	if mr.current != nil {
+		if _, err := io.Copy(io.Discard, mr.current); err != nil {
+			return nil, err
+		}
+		mr.current = nil
+	}
+
+	if !mr.started {
+		if err := mr.skipPreamble(); err != nil {
+			return nil, err
+		}
+		mr.started = true
+	} else {
+		if _, err := mr.br.Discard(len(mr.nlDashBoundary)); err != nil {
+			return nil, err
+		}
+	}
+	if last, err := mr.readBoundaryEnd(); err != nil {
+		return nil, err
+	} else if last {
+		mr.done = true
+		return nil, io.EOF
+	}
+
+	h, err := mr.readPartHeaders()
+	if err != nil {
+		return nil, err
+	}
+	mr.current = &Part{Headers: h, mr: mr}
+	return mr.current, nil
+}
+
+// skipPreamble reads up to and including the first "--boundary"
+func (mr *MultipartReader) skipPreamble() error {
+	for {
+		peek, err := mr.br.Peek(len(mr.dashBoundary))
+		if bytes.Equal(peek, mr.dashBoundary) {
+			_, err := mr.br.Discard(len(mr.dashBoundary))
+			return err
+		}
+		if err != nil {
+			return ErrMalformedMultipart
+		}
+		// not a boundary, skip the line
+		for {
+			_, err = mr.br.ReadSlice('\n')
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if err != nil {
+			return ErrMalformedMultipart
+		}
+	}
+}
+
+// readBoundaryEnd consumes the rest of a boundary line, reporting whether
+// it was the closing "--boundary--".
+func (mr *MultipartReader) readBoundaryEnd() (last bool, err error) {
+	line, err := mr.br.ReadSlice('\n')
+	if err == io.EOF && bytes.HasPrefix(line, []byte("--")) {
+		// some clients leave off the final CRLF
+		return true, nil
+	}
+	if err != nil {
+		return false, ErrMalformedMultipart
+	}
+	last = bytes.HasPrefix(line, []byte("--"))
+	if last {
+		line = line[2:]
+	}
+	// transport padding
+	if len(bytes.TrimRight(line, " \t\r\n")) != 0 {
+		return false, ErrMalformedMultipart
+	}
+	return last, nil
+}
+
+func (mr *MultipartReader) readPartHeaders() (headers.Headers, error) {
+	h := headers.NewHeaders()
+	read := 0
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		read += len(line)
+		if read > maxPartHeaderBytes || err == bufio.ErrBufferFull {
+			return nil, ErrPartHeadersTooLarge
+		}
+		if err != nil {
+			return nil, ErrMalformedMultipart
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			return h, nil
+		}
+		if err := h.ParseHearderLine(line); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Part is one part of a multipart body, reading it yields its content.
+type Part struct {
+	Headers headers.Headers
+	mr      *MultipartReader
+	eof     bool
+}
+
+func (p *Part) Read(b []byte) (int, error) {
+	if p.eof {
+		return 0, io.EOF
+	}
+	br := p.mr.br
+	delim := p.mr.nlDashBoundary
+
+	peek, err := br.Peek(max(br.Buffered(), len(delim)))
+	if i := bytes.Index(peek, delim); i >= 0 {
+		if i == 0 {
+			p.eof = true
+			return 0, io.EOF
+		}
+		n := copy(b, peek[:i])
+		br.Discard(n)
+		return n, nil
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	// the tail could be the start of the delimiter
+	n := copy(b, peek[:len(peek)-len(delim)+1])
+	br.Discard(n)
+	return n, nil
+}
+
+// FormName returns the name parameter of a form-data Content-Disposition,
+// empty if there is none.
+func (p *Part) FormName() string {
+	params := p.disposition()
+	return params["name"]
+}
+
+// FileName returns the base name of the filename parameter of the
+// Content-Disposition, empty for parts that aren't files.
+func (p *Part) FileName() string {
+	name := p.disposition()["filename"]
+	if name == "" {
+		return ""
+	}
+	return filepath.Base(filepath.Clean("/" + name))
+}
+
+func (p *Part) disposition() map[string]string {
+	v, _ := p.Headers.Get("Content-Disposition")
+	disposition, params, err := mime.ParseMediaType(v)
+	if err != nil || disposition != "form-data" {
+		return nil
+	}
+	return params
+}
+
+var (
+	ErrInvalidBoundary     = errors.New("multipart: invalid boundary")
+	ErrMalformedMultipart  = errors.New("multipart: malformed body")
+	ErrPartHeadersTooLarge = errors.New("multipart: part headers too large")
+)
@@ -2,6 +2,7 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,10 @@ import (
 var Crlf = []byte("\r\n")
 var CrlfLen = len(Crlf)
 
+// MaxBodySize is the largest Content-Length accepted, the body is read
+// into memory as a whole before the handler runs.
+const MaxBodySize = 64 << 20
+
 type RequestLine struct {
 	Method      string
 	Target      string
@@ -24,12 +29,41 @@ type Request struct {
 	*RequestLine
 	headers.Headers
 	Body []byte
+
+	// RemoteAddr is the network address of the client, set by the server.
+	RemoteAddr string
+
+	ctx       context.Context
+	formState *formState
 }
 
 func NewRequest() *Request {
 	return &Request{
-		Headers: headers.NewHeaders(),
+		Headers:   headers.NewHeaders(),
+		formState: &formState{},
+	}
+}
+
+// Context returns the request's context. It is cancelled when the client
+// disconnects, the server shuts down or the request times out.
+// The returned context is never nil, it defaults to context.Background.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
 	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of r with its context changed to ctx.
+// Middleware uses it to hand a derived context down to the next handler.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
 }
 
 type parseState int
@@ -131,9 +165,12 @@ func (rp *RequestParser) parse(data []byte) (int, error) {
 				continue
 			}
 			contLen, err := strconv.ParseInt(contLenStr, 10, 64)
-			if err != nil {
+			if err != nil || contLen < 0 {
 				return 0, ErrInvalidContentLength
 			}
+			if contLen > MaxBodySize {
+				return 0, ErrBodyTooLarge
+			}
 			if contLen == 0 {
 				rp.state = StateDone
 				continue
@@ -189,6 +226,7 @@ var (
 	ErrUnsupportedVersion           = errors.New("version not supported")
 	ErrInvalidContentLength         = errors.New("invalid content length")
 	ErrBodyGreaterThanContentLength = errors.New("body greater than the content length")
+	ErrBodyTooLarge                 = errors.New("body too large")
 )
 
 func IsVersionSupported(httpVersion string) bool {
@@ -220,6 +220,29 @@ func TestBodyParse(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, ErrBodyGreaterThanContentLength, err)
 
+	// Test: Content-Length over MaxBodySize (should error before reading)
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			fmt.Sprintf("Content-Length: %d\r\n", MaxBodySize+1) +
+			"\r\n" +
+			"some body",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	assert.Equal(t, ErrBodyTooLarge, err)
+
+	// Test: Negative Content-Length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: -1\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	assert.Equal(t, ErrInvalidContentLength, err)
+
 	// Test: Invalid Content-Length (non-numeric)
 	reader = &chunkReader{
 		data: "POST /submit HTTP/1.1\r\n" +
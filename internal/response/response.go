@@ -1,10 +1,11 @@
 package response
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net"
 	"strconv"
 	"strings"
 
@@ -13,10 +14,22 @@ import (
 
 const ContentLength = "Content-Length"
 const TransferEncoding = "Transfer-Encoding"
+const ContentEncoding = "Content-Encoding"
+const ContentType = "Content-Type"
+const ETag = "ETag"
+const LastModified = "Last-Modified"
+const Vary = "Vary"
+const SetCookie = "Set-Cookie"
+
+// DefaultBufferSize is the size of the Writer's output buffer, chunked
+// bodies are sent in chunks of up to this size unless flushed earlier.
+// A body that fits in it entirely is sent with a Content-Length instead.
+const DefaultBufferSize = 4096
 
 type Response struct {
 	headers    headers.Headers
 	statusCode int
+	reason     string
 	contentLen int
 	chunked    bool
 }
@@ -24,7 +37,8 @@ type Response struct {
 func NewResponse(h headers.Headers) *Response {
 	return &Response{
 		headers:    h,
-		statusCode: 200,
+		statusCode: StatusOK,
+		reason:     StatusText(StatusOK),
 		chunked:    true,
 	}
 }
@@ -37,22 +51,49 @@ const (
 	StateWroteHeader
 	StateWroteBody
 	StateError
+	StateHijacked
 )
 
 type Writer struct {
 	*Response
 	writer io.Writer
+	// buf holds everything on its way to writer, so the status line,
+	// headers and start of the body leave in one packet.
+	buf *bufio.Writer
+	// chunks merges small writes into bigger chunks.
+	chunks  *bufio.Writer
+	bufSize int
+	// pending holds the body back until it outgrows bufSize or the
+	// response is finished, in which case its exact length is known.
+	pending     []byte
+	bodyStarted bool
+	// discard drops the body but keeps counting it, for HEAD requests
+	discard   bool
+	discarded int
+	// replaced drops the body silently, see Replace
+	replaced bool
 	writeState
 	bytesWritten int
 	lastError    error
+
+	beforeHeaders []func(w *Writer)
+	encoder       io.WriteCloser
 }
 
 func NewResponseWriter(w io.Writer) *Writer {
+	return NewResponseWriterSize(w, DefaultBufferSize)
+}
+
+// NewResponseWriterSize returns a Writer buffering up to size bytes of
+// output before it is sent to w.
+func NewResponseWriterSize(w io.Writer, size int) *Writer {
 	h := DefaultHeaders()
 	resp := NewResponse(h)
 	return &Writer{
 		Response:   resp,
 		writer:     w,
+		buf:        bufio.NewWriterSize(w, size),
+		bufSize:    size,
 		writeState: StateInitial,
 	}
 }
@@ -61,14 +102,65 @@ func (w *Writer) Headers() headers.Headers {
 	return w.headers
 }
 
+func (w *Writer) StatusCode() int {
+	return w.statusCode
+}
+
+// SetRequestMethod tells the Writer which request it answers. For HEAD the
+// headers are sent as they would be for GET, including a Content-Length
+// computed from what the handler writes, but the body itself is dropped.
+func (w *Writer) SetRequestMethod(method string) {
+	w.discard = method == "HEAD"
+}
+
+// OnWriteHeaders registers fn to run right before the headers are written,
+// it is the last chance to change them. Hooks run in the order they were
+// registered.
+func (w *Writer) OnWriteHeaders(fn func(w *Writer)) {
+	w.beforeHeaders = append(w.beforeHeaders, fn)
+}
+
+// EncodeBody passes the body through the encoder returned by newEncoder,
+// e.g. a compressor, before it is framed. It must be called from an
+// OnWriteHeaders hook, the encoder is closed by Finish.
+func (w *Writer) EncodeBody(newEncoder func(io.Writer) io.WriteCloser) {
+	w.encoder = newEncoder(bodyWriter{w})
+}
+
+// bodyWriter frames whatever the encoder produces
+type bodyWriter struct {
+	w *Writer
+}
+
+func (bw bodyWriter) Write(p []byte) (int, error) {
+	return bw.w.writeBody(p)
+}
+
+// chunkWriter sends every write as one chunk
+type chunkWriter struct {
+	w *Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	buf := cw.w.buf
+	fmt.Fprintf(buf, "%x\r\n", len(p))
+	buf.Write(p)
+	_, err := buf.WriteString("\r\n")
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 func (w *Writer) upgradeWriteStatus(ws writeState) error {
 	for w.writeState < ws {
 		switch w.writeState {
 		case StateInitial:
-			err := w.WriteStatus(200)
-			if err != nil {
-				return err
-			}
+			// status code defaults to 200
+			w.writeState = StateWroteStatus
 		case StateWroteStatus:
 			err := w.writeHeaders()
 			if err != nil {
@@ -79,30 +171,184 @@ func (w *Writer) upgradeWriteStatus(ws writeState) error {
 	return nil
 }
 
+// Err returns the error that broke the response stream, if any.
+// Once it is set every Write fails with it, so handlers should stop
+// producing output.
+func (w *Writer) Err() error {
+	return w.lastError
+}
+
 func (w *Writer) setWriteError(err error) error {
 	w.lastError = err
 	w.writeState = StateError
 	return err
 }
 
-// transfer encoding chucked is used when content-length is not set
+// Hijacker is implemented by connections that can be taken over by a handler.
+type Hijacker interface {
+	// Hijack hands over the connection, after it returns the server no
+	// longer reads from, writes to or closes it.
+	Hijack() (net.Conn, error)
+}
+
+// Hijack writes the status line and headers, e.g. a 101 Switching Protocols,
+// and hands the raw connection over to the caller, who becomes responsible
+// for closing it. The Writer must not be used afterwards.
+func (w *Writer) Hijack() (net.Conn, error) {
+	if w.lastError != nil {
+		return nil, w.lastError
+	}
+	hj, ok := w.writer.(Hijacker)
+	if !ok {
+		return nil, ErrNotHijackable
+	}
+	if w.writeState >= StateWroteHeader {
+		return nil, ErrHeadersAlreadyWritten
+	}
+
+	conn, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.upgradeWriteStatus(StateWroteHeader); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := w.buf.Flush(); err != nil {
+		conn.Close()
+		return nil, w.setWriteError(err)
+	}
+	w.writeState = StateHijacked
+	return conn, nil
+}
+
+func (w *Writer) Hijacked() bool {
+	return w.writeState == StateHijacked
+}
+
+// Committed reports whether the status line and headers have been handed
+// to the connection, after that the response can't be replaced anymore.
+func (w *Writer) Committed() bool {
+	return w.writeState >= StateWroteHeader
+}
+
+// Reset drops the status and the body held back so far, so that another
+// response, e.g. an error, can be written instead. Headers are kept except
+// for the ones describing the dropped body.
+func (w *Writer) Reset() error {
+	if w.Committed() {
+		return ErrHeadersAlreadyWritten
+	}
+	w.headers.Del(ContentLength)
+	w.headers.Del(ContentEncoding)
+	w.headers.Del(ContentType)
+	w.headers.Del(ETag)
+	w.headers.Del(LastModified)
+	w.statusCode = StatusOK
+	w.reason = StatusText(StatusOK)
+	w.writeState = StateInitial
+	w.pending = nil
+	w.bodyStarted = false
+	w.discarded = 0
+	return nil
+}
+
+// Replace turns the response into an empty one with statusCode, dropping
+// the body written so far and everything written after. Unlike Reset it
+// works from an OnWriteHeaders hook, e.g. to answer with 304 Not Modified
+// once the handler has set an ETag.
+func (w *Writer) Replace(statusCode int) error {
+	if w.Committed() {
+		return ErrHeadersAlreadyWritten
+	}
+	if err := validateStatus(statusCode, ""); err != nil {
+		return err
+	}
+	w.statusCode = statusCode
+	w.reason = StatusText(statusCode)
+	w.pending = nil
+	w.discard = true
+	w.replaced = true
+	w.discarded = 0
+	w.encoder = nil
+	if BodyAllowed(statusCode) {
+		w.headers.Del(ContentEncoding)
+		w.headers.Set(ContentLength, "0")
+	}
+	return nil
+}
+
+// Write sends p as part of the body. Without a Content-Length header the
+// body is held back until it outgrows the buffer, then transfer encoding
+// chunked is used. A body finished within the buffer gets an exact
+// Content-Length.
 func (w *Writer) Write(p []byte) (n int, err error) {
 	if w.lastError != nil {
 		return 0, w.lastError
 	}
-	if err := w.upgradeWriteStatus(StateWroteHeader); err != nil {
-		return 0, err
+	if w.writeState == StateHijacked {
+		return 0, ErrHijacked
+	}
+	if len(p) > 0 && !BodyAllowed(w.statusCode) && !w.replaced {
+		return 0, ErrBodyNotAllowed
+	}
+	w.bodyStarted = true
+	if w.discard {
+		w.discarded += len(p)
+		return len(p), nil
+	}
+	if w.writeState < StateWroteHeader {
+		_, hasLen := w.headers.Get(ContentLength)
+		if !hasLen && len(w.pending)+len(p) <= w.bufSize {
+			w.pending = append(w.pending, p...)
+			return len(p), nil
+		}
+		if err := w.commit(); err != nil {
+			return 0, err
+		}
+		if w.discard {
+			// replaced while committing
+			return len(p), nil
+		}
 	}
 	if len(p) == 0 {
 		return 0, nil
 	}
+	return w.writeEncoded(p)
+}
+
+// commit writes the status line and headers followed by the held back body.
+func (w *Writer) commit() error {
+	if err := w.upgradeWriteStatus(StateWroteHeader); err != nil {
+		return err
+	}
+	if len(w.pending) == 0 {
+		return nil
+	}
+	pending := w.pending
+	w.pending = nil
+	_, err := w.writeEncoded(pending)
+	return err
+}
+
+func (w *Writer) writeEncoded(p []byte) (n int, err error) {
+	if w.encoder != nil {
+		n, err := w.encoder.Write(p)
+		if err != nil {
+			return n, w.setWriteError(err)
+		}
+		return n, nil
+	}
+	return w.writeBody(p)
+}
 
+func (w *Writer) writeBody(p []byte) (n int, err error) {
 	if w.chunked {
-		err := w.writeChunk(p)
+		n, err := w.chunks.Write(p)
 		if err != nil {
-			return 0, err
+			return n, w.setWriteError(err)
 		}
-		return len(p), nil
+		return n, nil
 	}
 
 	if w.bytesWritten+len(p) > w.contentLen {
@@ -110,7 +356,7 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 		return 0, ErrWriteMoreThanContentLength
 	}
 
-	n, err = w.writer.Write(p)
+	n, err = w.buf.Write(p)
 	if err != nil {
 		w.setWriteError(err)
 	}
@@ -118,43 +364,79 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
-func (w *Writer) writeChunk(p []byte) error {
-	chunkHeader := fmt.Sprintf("%x\r\n", len(p))
-	_, err := w.writer.Write([]byte(chunkHeader))
-	if err != nil {
-		return w.setWriteError(err)
+// Flush sends everything buffered so far to the client, writing the status
+// line and headers first if needed. Streaming handlers call it whenever
+// the client should see what was written, e.g. after each event.
+func (w *Writer) Flush() error {
+	if w.lastError != nil {
+		return w.lastError
+	}
+	if w.writeState == StateHijacked {
+		return ErrHijacked
+	}
+	if err := w.commit(); err != nil {
+		return err
+	}
+	if w.discard {
+		return w.flushBuf()
 	}
 
-	p = append(p, '\r', '\n')
-	_, err = w.writer.Write(p)
-	if err != nil {
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return w.setWriteError(err)
+		}
+	}
+	if w.chunked {
+		if err := w.chunks.Flush(); err != nil {
+			return w.setWriteError(err)
+		}
+	}
+	return w.flushBuf()
+}
+
+func (w *Writer) flushBuf() error {
+	if err := w.buf.Flush(); err != nil {
 		return w.setWriteError(err)
 	}
 	return nil
 }
 
-// writes status directly to the connection
+// WriteStatus sets the status code, with the reason phrase registered for
+// it. The status line is sent together with the headers, so it can be
+// changed until the first Write or Flush.
 func (w *Writer) WriteStatus(statusCode int) error {
-	if w.writeState > StateWroteStatus {
+	return w.WriteStatusReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusReason is WriteStatus with a reason phrase of the caller's
+// choosing, the reason may be empty.
+func (w *Writer) WriteStatusReason(statusCode int, reason string) error {
+	if w.writeState > StateWroteStatus || w.bodyStarted {
 		return ErrStatusAlreadyWritten
 	}
-
-	reason := http.StatusText(statusCode)
-	if reason == "" {
-		return errors.New("bad status code")
+	if err := validateStatus(statusCode, reason); err != nil {
+		return err
 	}
 
-	_, err := fmt.Fprintf(w.writer, "HTTP/1.1 %d %s\r\n", statusCode, reason)
-	if err != nil {
-		return w.setWriteError(err)
-	}
 	w.statusCode = statusCode
+	w.reason = reason
 	w.writeState = StateWroteStatus
 	return nil
 }
 
 func (w *Writer) writeHeaders() error {
-	if contLenStr, ok := w.headers.Get(ContentLength); ok {
+	hooks := w.beforeHeaders
+	w.beforeHeaders = nil
+	for _, fn := range hooks {
+		fn(w)
+	}
+
+	if !BodyAllowed(w.statusCode) {
+		// nothing follows the headers, or for 101 another protocol does
+		w.chunked = false
+		w.headers.Del(ContentLength)
+		w.headers.Del(TransferEncoding)
+	} else if contLenStr, ok := w.headers.Get(ContentLength); ok {
 		contLen, err := strconv.Atoi(contLenStr)
 		if err != nil {
 			return ErrInvalidContentLength
@@ -165,17 +447,24 @@ func (w *Writer) writeHeaders() error {
 	} else {
 		w.chunked = true
 		w.headers.Set(TransferEncoding, "chunked")
+		w.chunks = bufio.NewWriterSize(chunkWriter{w}, w.bufSize)
 	}
 
-	hLines := []byte{}
+	hLines := fmt.Appendf(nil, "HTTP/1.1 %d %s\r\n", w.statusCode, w.reason)
 	for key, vals := range w.headers {
+		if strings.EqualFold(key, SetCookie) {
+			// Set-Cookie can't be folded into one line, RFC 9110 section 5.3
+			for _, val := range vals {
+				hLines = fmt.Appendf(hLines, "%s: %s\r\n", key, val)
+			}
+			continue
+		}
 		val := strings.Join(vals, ",")
 		hLines = fmt.Appendf(hLines, "%s: %s\r\n", key, val)
 	}
 	hLines = fmt.Append(hLines, "\r\n")
 
-	// fmt.Println("About to write headers!\n", string(hLines))
-	_, err := w.writer.Write(hLines)
+	_, err := w.buf.Write(hLines)
 	if err != nil {
 		return w.setWriteError(err)
 	}
@@ -190,29 +479,55 @@ func (w *Writer) Finish() error {
 	if w.lastError != nil {
 		return w.lastError
 	}
+	if w.writeState == StateHijacked {
+		return nil
+	}
 	if w.writeState < StateWroteHeader {
-		w.headers.Set(ContentLength, "0")
-		if err := w.upgradeWriteStatus(StateWroteHeader); err != nil {
+		if _, ok := w.headers.Get(ContentLength); !ok && BodyAllowed(w.statusCode) {
+			w.headers.Set(ContentLength, strconv.Itoa(len(w.pending)+w.discarded))
+		}
+		if err := w.commit(); err != nil {
 			return err
 		}
 	}
+	if w.discard || !BodyAllowed(w.statusCode) {
+		return w.flushBuf()
+	}
+
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			return w.setWriteError(err)
+		}
+	}
 
 	if w.chunked {
-		_, err := io.WriteString(w.writer, "0\r\n\r\n")
+		if err := w.chunks.Flush(); err != nil {
+			return w.setWriteError(err)
+		}
+		w.buf.WriteString("0\r\n\r\n")
+	}
+	if err := w.flushBuf(); err != nil {
 		return err
 	}
 
-	if w.bytesWritten != w.contentLen {
+	if !w.chunked && w.bytesWritten != w.contentLen {
 		return io.ErrShortWrite
 	}
 
 	return nil
 }
 
+// BodyAllowed reports whether a response with statusCode may have a body.
+// 1xx, 204 No Content and 304 Not Modified responses end with the headers
+// and carry neither Content-Length nor Transfer-Encoding.
+func BodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
+}
+
 func DefaultHeaders() headers.Headers {
 	h := headers.NewHeaders()
 	h.Set("Connection", "close")
-	h.Set("Content-Type", "text/plain")
+	h.Set(ContentType, "text/plain")
 	return h
 }
 
@@ -220,4 +535,8 @@ var (
 	ErrStatusAlreadyWritten       = errors.New("status already written")
 	ErrWriteMoreThanContentLength = errors.New("attempting to write more than content lenght")
 	ErrInvalidContentLength       = errors.New("invalid content length")
+	ErrNotHijackable              = errors.New("connection does not support hijacking")
+	ErrHeadersAlreadyWritten      = errors.New("headers already written")
+	ErrHijacked                   = errors.New("connection has been hijacked")
+	ErrBodyNotAllowed             = errors.New("response status does not allow a body")
 )
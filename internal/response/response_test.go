@@ -52,6 +52,7 @@ func Test_DefaultChunkedResponse(t *testing.T) {
 
 	_, err := w.Write([]byte("Hello"))
 	require.NoError(t, err)
+	require.NoError(t, w.Flush())
 	require.NoError(t, w.Finish())
 
 	p := parseHTTP(buf.Bytes())
@@ -121,3 +122,297 @@ func Test_WriteMoreThanContentLength(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, ErrWriteMoreThanContentLength, err)
 }
+
+// recorder keeps every Write separately, like packets on the wire
+type recorder struct {
+	writes []string
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func Test_SmallWritesMerged(t *testing.T) {
+	rec := &recorder{}
+	w := NewResponseWriter(rec)
+	for _, s := range []string{"a", "b", "c"} {
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	assert.Empty(t, rec.writes)
+	require.NoError(t, w.Finish())
+
+	require.Len(t, rec.writes, 1)
+	p := parseHTTP([]byte(rec.writes[0]))
+	assert.Equal(t, "HTTP/1.1 200 OK", p.statusLine)
+	assert.Equal(t, "abc", p.body)
+}
+
+func Test_Flush(t *testing.T) {
+	rec := &recorder{}
+	w := NewResponseWriter(rec)
+	_, err := w.Write([]byte("ab"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+
+	// status line, headers and first chunk share a packet
+	require.Len(t, rec.writes, 1)
+	p := parseHTTP([]byte(rec.writes[0]))
+	assert.Equal(t, "HTTP/1.1 200 OK", p.statusLine)
+	assert.Equal(t, "2\r\nab\r\n", p.body)
+
+	_, err = w.Write([]byte("cd"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	require.Len(t, rec.writes, 2)
+	assert.Equal(t, "2\r\ncd\r\n0\r\n\r\n", rec.writes[1])
+}
+
+func Test_BufferSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponseWriterSize(&buf, 16)
+	body := strings.Repeat("x", 40)
+	_, err := w.Write([]byte("hi"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	p := parseHTTP(buf.Bytes())
+	assert.Equal(t, "10\r\nhi"+body[:14]+"\r\n1a\r\n"+body[14:]+"\r\n0\r\n\r\n", p.body)
+}
+
+func Test_StatusChangeBeforeWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponseWriter(&buf)
+	require.NoError(t, w.WriteStatus(200))
+	require.NoError(t, w.WriteStatus(404))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, ErrStatusAlreadyWritten, w.WriteStatus(500))
+
+	p := parseHTTP(buf.Bytes())
+	assert.Equal(t, "HTTP/1.1 404 Not Found", p.statusLine)
+}
+
+func Test_AutoContentLength(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponseWriter(&buf)
+	_, err := w.Write([]byte("Hello, "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("World"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	p := parseHTTP(buf.Bytes())
+	assert.Equal(t, "12", p.headers["content-length"])
+	_, hasTE := p.headers["transfer-encoding"]
+	assert.False(t, hasTE)
+	assert.Equal(t, "Hello, World", p.body)
+
+	// Test: Body outgrows the buffer
+	buf.Reset()
+	w = NewResponseWriterSize(&buf, 8)
+	_, err = w.Write([]byte("Hello, "))
+	require.NoError(t, err)
+	assert.Equal(t, 0, buf.Len())
+	_, err = w.Write([]byte("World"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	p = parseHTTP(buf.Bytes())
+	assert.Equal(t, "chunked", p.headers["transfer-encoding"])
+	_, hasCL := p.headers["content-length"]
+	assert.False(t, hasCL)
+	assert.Equal(t, "8\r\nHello, W\r\n4\r\norld\r\n0\r\n\r\n", p.body)
+
+	// Test: Status is locked once the body started
+	w = NewResponseWriter(&buf)
+	_, err = w.Write([]byte("Hello"))
+	require.NoError(t, err)
+	assert.Equal(t, ErrStatusAlreadyWritten, w.WriteStatus(500))
+
+	// Test: No body
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	require.NoError(t, w.Finish())
+	p = parseHTTP(buf.Bytes())
+	assert.Equal(t, "0", p.headers["content-length"])
+}
+
+func Test_Head(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponseWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	body := strings.Repeat("x", 2*DefaultBufferSize)
+	_, err := w.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	p := parseHTTP(buf.Bytes())
+	assert.Equal(t, "HTTP/1.1 200 OK", p.statusLine)
+	assert.Equal(t, strconv.Itoa(len(body)), p.headers["content-length"])
+	assert.Equal(t, "", p.body)
+
+	// Test: Handler set Content-Length is kept
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	w.Headers().Set(ContentLength, "100")
+	require.NoError(t, w.Finish())
+	p = parseHTTP(buf.Bytes())
+	assert.Equal(t, "100", p.headers["content-length"])
+	assert.Equal(t, "", p.body)
+
+	// Test: Flushed stream keeps its chunked headers, without the body
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	_, err = w.Write([]byte("event"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Finish())
+	p = parseHTTP(buf.Bytes())
+	assert.Equal(t, "chunked", p.headers["transfer-encoding"])
+	assert.Equal(t, "", p.body)
+}
+
+func Test_NoBodyStatuses(t *testing.T) {
+	for _, code := range []int{100, 101, 103, 204, 304} {
+		var buf bytes.Buffer
+		w := NewResponseWriter(&buf)
+		w.Headers().Set(ContentLength, "10")
+		require.NoError(t, w.WriteStatus(code))
+
+		_, err := w.Write([]byte("body"))
+		assert.Equal(t, ErrBodyNotAllowed, err, code)
+		_, err = w.Write(nil)
+		assert.NoError(t, err, code)
+		require.NoError(t, w.Finish(), code)
+
+		raw := buf.String()
+		assert.True(t, strings.HasPrefix(raw, "HTTP/1.1 "+strconv.Itoa(code)+" "), code)
+		assert.True(t, strings.HasSuffix(raw, "\r\n\r\n"), code)
+		p := parseHTTP(buf.Bytes())
+		_, hasCL := p.headers["content-length"]
+		_, hasTE := p.headers["transfer-encoding"]
+		assert.False(t, hasCL, code)
+		assert.False(t, hasTE, code)
+		assert.Equal(t, "", p.body, code)
+	}
+
+	// Test: Flushed 204 has no chunked terminator
+	var buf bytes.Buffer
+	w := NewResponseWriter(&buf)
+	require.NoError(t, w.WriteStatus(204))
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "0\r\n\r\n")
+
+	// Test: HEAD with 304 stays quiet too
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatus(304))
+	require.NoError(t, w.Finish())
+	p := parseHTTP(buf.Bytes())
+	_, hasCL := p.headers["content-length"]
+	assert.False(t, hasCL)
+}
+
+func Test_CustomStatus(t *testing.T) {
+	// Test: Unknown code in range goes out with an empty reason
+	var buf bytes.Buffer
+	w := NewResponseWriter(&buf)
+	require.NoError(t, w.WriteStatus(299))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 299 \r\n"))
+
+	// Test: Registered code uses its reason
+	require.NoError(t, RegisterStatus(499, "Client Closed Request"))
+	assert.Equal(t, "Client Closed Request", StatusText(499))
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	require.NoError(t, w.WriteStatus(499))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 499 Client Closed Request\r\n"))
+
+	// Test: Explicit reason
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	require.NoError(t, w.WriteStatusReason(StatusNotFound, "No Such Widget"))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 No Such Widget\r\n"))
+
+	// Test: Invalid codes and reasons
+	w = NewResponseWriter(io.Discard)
+	assert.Equal(t, ErrInvalidStatusCode, w.WriteStatus(99))
+	assert.Equal(t, ErrInvalidStatusCode, w.WriteStatus(600))
+	assert.Equal(t, ErrInvalidReason, w.WriteStatusReason(200, "OK\r\nX-Injected: 1"))
+	assert.Equal(t, ErrInvalidStatusCode, RegisterStatus(1000, "Too Big"))
+	assert.Equal(t, StatusOK, w.StatusCode())
+}
+
+func Test_Reset(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponseWriter(&buf)
+	w.Headers().Set("X-Kept", "yes")
+	w.Headers().Set(ContentLength, "100")
+	require.NoError(t, w.WriteStatus(StatusCreated))
+	require.NoError(t, w.Reset())
+	assert.False(t, w.Committed())
+
+	require.NoError(t, w.WriteStatus(StatusTeapot))
+	_, err := w.Write([]byte("short"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	p := parseHTTP(buf.Bytes())
+	assert.Equal(t, "HTTP/1.1 418 I'm a teapot", p.statusLine)
+	assert.Equal(t, "yes", p.headers["x-kept"])
+	assert.Equal(t, "5", p.headers["content-length"])
+	assert.Equal(t, "short", p.body)
+
+	// Test: Too late once committed
+	assert.True(t, w.Committed())
+	assert.Equal(t, ErrHeadersAlreadyWritten, w.Reset())
+}
+
+func Test_Replace(t *testing.T) {
+	// Test: From a hook, once the body outgrew the buffer
+	var buf bytes.Buffer
+	w := NewResponseWriterSize(&buf, 16)
+	w.Headers().Set("ETag", `"v1"`)
+	w.OnWriteHeaders(func(w *Writer) {
+		require.NoError(t, w.Replace(StatusNotModified))
+	})
+	for range 4 {
+		n, err := w.Write([]byte("0123456789"))
+		require.NoError(t, err)
+		assert.Equal(t, 10, n)
+	}
+	require.NoError(t, w.Finish())
+	p := parseHTTP(buf.Bytes())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified", p.statusLine)
+	assert.Equal(t, `"v1"`, p.headers["etag"])
+	assert.NotContains(t, p.headers, "content-length")
+	assert.NotContains(t, p.headers, "transfer-encoding")
+	assert.Equal(t, "", p.body)
+
+	// Test: Status allowing a body, held back at Finish
+	buf.Reset()
+	w = NewResponseWriter(&buf)
+	w.OnWriteHeaders(func(w *Writer) {
+		require.NoError(t, w.Replace(StatusPreconditionFailed))
+	})
+	_, err := w.Write([]byte("dropped"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	p = parseHTTP(buf.Bytes())
+	assert.Equal(t, "HTTP/1.1 412 Precondition Failed", p.statusLine)
+	assert.Equal(t, "0", p.headers["content-length"])
+	assert.Equal(t, "", p.body)
+
+	// Test: Too late once committed
+	assert.Equal(t, ErrHeadersAlreadyWritten, w.Replace(StatusOK))
+}
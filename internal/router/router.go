@@ -0,0 +1,112 @@
+package router
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const Allow = "Allow"
+
+// Router dispatches requests on their method and path. A path ending in
+// "/" matches everything below it, the longest match wins.
+// HEAD requests fall back to the GET handler, the Writer drops the body.
+type Router struct {
+	routes map[string]map[string]server.Handler
+	// NotFound handles requests no route matches, defaults to a plain 404.
+	NotFound server.Handler
+}
+
+func New() *Router {
+	return &Router{
+		routes:   make(map[string]map[string]server.Handler),
+		NotFound: notFound,
+	}
+}
+
+// Handle registers h for method on path.
+func (rt *Router) Handle(method, path string, h server.Handler) {
+	methods, ok := rt.routes[path]
+	if !ok {
+		methods = make(map[string]server.Handler)
+		rt.routes[path] = methods
+	}
+	methods[method] = h
+}
+
+func (rt *Router) Get(path string, h server.Handler) {
+	rt.Handle("GET", path, h)
+}
+
+func (rt *Router) Post(path string, h server.Handler) {
+	rt.Handle("POST", path, h)
+}
+
+// Serve is the server.Handler of the router.
+func (rt *Router) Serve(w *response.Writer, r *request.Request) error {
+	methods, ok := rt.match(Path(r.Target))
+	if !ok {
+		return rt.NotFound(w, r)
+	}
+
+	h, ok := methods[r.Method]
+	if !ok && r.Method == "HEAD" {
+		h, ok = methods["GET"]
+	}
+	if !ok {
+		w.Headers().Set(Allow, allowed(methods))
+		if err := w.WriteStatus(response.StatusMethodNotAllowed); err != nil {
+			return err
+		}
+		_, err := w.Write([]byte("Method not allowed\n"))
+		return err
+	}
+	return h(w, r)
+}
+
+func (rt *Router) match(path string) (map[string]server.Handler, bool) {
+	if methods, ok := rt.routes[path]; ok {
+		return methods, true
+	}
+	best := ""
+	for pattern := range rt.routes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return nil, false
+	}
+	return rt.routes[best], true
+}
+
+// Path returns the path of a request target, without the query.
+func Path(target string) string {
+	path, _, _ := strings.Cut(target, "?")
+	return path
+}
+
+func allowed(methods map[string]server.Handler) string {
+	names := make([]string, 0, len(methods)+1)
+	for method := range methods {
+		names = append(names, method)
+	}
+	if _, ok := methods["GET"]; ok {
+		if _, ok := methods["HEAD"]; !ok {
+			names = append(names, "HEAD")
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func notFound(w *response.Writer, r *request.Request) error {
+	if err := w.WriteStatus(response.StatusNotFound); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte("Not found\n"))
+	return err
+}
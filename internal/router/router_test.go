@@ -0,0 +1,79 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+func reply(body string) server.Handler {
+	return func(w *response.Writer, r *request.Request) error {
+		_, err := w.Write([]byte(body))
+		return err
+	}
+}
+
+func serve(t *testing.T, rt *Router, method, target string) string {
+	t.Helper()
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: method, Target: target, HttpVersion: "1.1"}
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	w.SetRequestMethod(method)
+	require.NoError(t, rt.Serve(w, r))
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	rt.Get("/coffee", reply("coffee"))
+	rt.Post("/coffee", reply("brewing"))
+	rt.Get("/static/", reply("static"))
+	rt.Get("/static/img/", reply("img"))
+
+	resp := serve(t, rt, "GET", "/coffee?size=large")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\ncoffee"))
+
+	resp = serve(t, rt, "POST", "/coffee")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nbrewing"))
+
+	// Test: Prefix routes, longest wins
+	resp = serve(t, rt, "GET", "/static/css/main.css")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nstatic"))
+	resp = serve(t, rt, "GET", "/static/img/logo.png")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nimg"))
+
+	// Test: Not found
+	resp = serve(t, rt, "GET", "/tea")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Method not allowed
+	resp = serve(t, rt, "DELETE", "/coffee")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "allow: GET, HEAD, POST\r\n")
+}
+
+func TestHeadFallback(t *testing.T) {
+	rt := New()
+	rt.Get("/coffee", reply("coffee"))
+
+	resp := serve(t, rt, "HEAD", "/coffee")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "content-length: 6\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: Explicit HEAD handler wins
+	rt.Handle("HEAD", "/coffee", func(w *response.Writer, r *request.Request) error {
+		w.Headers().Set("X-Head", "1")
+		return nil
+	})
+	resp = serve(t, rt, "HEAD", "/coffee")
+	assert.Contains(t, resp, "x-head: 1\r\n")
+}
@@ -0,0 +1,170 @@
+package secure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	StrictTransportSecurity   = "Strict-Transport-Security"
+	ContentSecurityPolicy     = "Content-Security-Policy"
+	XContentTypeOptions       = "X-Content-Type-Options"
+	ReferrerPolicy            = "Referrer-Policy"
+	PermissionsPolicy         = "Permissions-Policy"
+	CrossOriginOpenerPolicy   = "Cross-Origin-Opener-Policy"
+	CrossOriginEmbedderPolicy = "Cross-Origin-Embedder-Policy"
+)
+
+// NoncePlaceholder is replaced in header values by the nonce of the
+// request, e.g. "script-src 'nonce-{nonce}'".
+const NoncePlaceholder = "{nonce}"
+
+// DefaultCSP only allows same origin resources, and inline scripts and
+// styles carrying the nonce of the request.
+const DefaultCSP = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; " +
+	"object-src 'none'; base-uri 'self'; frame-ancestors 'self'"
+
+// config maps lowercased header names to values, so options and
+// overrides replace each other whatever their casing.
+type config struct {
+	headers map[string]string
+}
+
+type Option func(*config)
+
+// WithHeader sets header name to value, an empty value leaves it out.
+func WithHeader(name, value string) Option {
+	name = strings.ToLower(name)
+	return func(c *config) {
+		if value == "" {
+			delete(c.headers, name)
+			return
+		}
+		c.headers[name] = value
+	}
+}
+
+// WithHSTS tells browsers to only use HTTPS for maxAge, e.g. two years
+// including subdomains. It isn't sent by default, only add it behind TLS.
+func WithHSTS(maxAge time.Duration, includeSubdomains, preload bool) Option {
+	v := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if includeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if preload {
+		v += "; preload"
+	}
+	return WithHeader(StrictTransportSecurity, v)
+}
+
+// WithCSP sets the Content-Security-Policy, defaults to DefaultCSP. Use
+// NoncePlaceholder for the per-request nonce, see Nonce.
+func WithCSP(policy string) Option {
+	return WithHeader(ContentSecurityPolicy, policy)
+}
+
+// WithReferrerPolicy defaults to strict-origin-when-cross-origin.
+func WithReferrerPolicy(policy string) Option {
+	return WithHeader(ReferrerPolicy, policy)
+}
+
+// WithPermissionsPolicy defaults to denying camera, microphone and
+// geolocation.
+func WithPermissionsPolicy(policy string) Option {
+	return WithHeader(PermissionsPolicy, policy)
+}
+
+// WithCOOP sets the Cross-Origin-Opener-Policy, defaults to same-origin.
+func WithCOOP(policy string) Option {
+	return WithHeader(CrossOriginOpenerPolicy, policy)
+}
+
+// WithCOEP sets the Cross-Origin-Embedder-Policy, not sent by default as
+// require-corp blocks cross-origin resources that don't opt in.
+func WithCOEP(policy string) Option {
+	return WithHeader(CrossOriginEmbedderPolicy, policy)
+}
+
+type state struct {
+	config
+	nonce string
+}
+
+type ctxKey struct{}
+
+// Nonce returns the nonce of r to put in the nonce attribute of inline
+// scripts and styles, empty if the middleware isn't installed.
+func Nonce(r *request.Request) string {
+	if st, ok := r.Context().Value(ctxKey{}).(*state); ok {
+		return st.nonce
+	}
+	return ""
+}
+
+// New returns a middleware adding security headers to every response.
+// A header the handler sets itself is left alone, routes needing other
+// values can also install Override.
+func New(opts ...Option) server.Middleware {
+	c := config{headers: make(map[string]string)}
+	defaults := []Option{
+		WithCSP(DefaultCSP),
+		WithHeader(XContentTypeOptions, "nosniff"),
+		WithReferrerPolicy("strict-origin-when-cross-origin"),
+		WithPermissionsPolicy("camera=(), microphone=(), geolocation=()"),
+		WithCOOP("same-origin"),
+	}
+	for _, opt := range append(defaults, opts...) {
+		opt(&c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			st := &state{
+				config: config{headers: maps.Clone(c.headers)},
+				nonce:  newNonce(),
+			}
+			w.OnWriteHeaders(func(w *response.Writer) {
+				h := w.Headers()
+				for name, value := range st.headers {
+					if _, ok := h.Get(name); ok {
+						continue
+					}
+					h.Set(name, strings.ReplaceAll(value, NoncePlaceholder, st.nonce))
+				}
+			})
+			return next(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, st)))
+		}
+	}
+}
+
+// Override returns a middleware changing the headers New adds for the
+// requests it handles, e.g. one route:
+//
+//	rt.Get("/embed", server.Chain(embed, secure.Override(secure.WithCOOP(""))))
+func Override(opts ...Option) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			if st, ok := r.Context().Value(ctxKey{}).(*state); ok {
+				for _, opt := range opts {
+					opt(&st.config)
+				}
+			}
+			return next(w, r)
+		}
+	}
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
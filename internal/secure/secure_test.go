@@ -0,0 +1,115 @@
+package secure
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+// serve runs h behind mws and returns the response headers and the nonce
+// h saw
+func serve(t *testing.T, h server.Handler, mws ...server.Middleware) (headers.Headers, string) {
+	t.Helper()
+	var nonce string
+	chain := server.Chain(func(w *response.Writer, r *request.Request) error {
+		nonce = Nonce(r)
+		return h(w, r)
+	}, mws...)
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "GET", Target: "/", HttpVersion: "1.1"}
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(t, chain(w, r))
+	require.NoError(t, w.Finish())
+
+	_, rest, _ := strings.Cut(buf.String(), "\r\n")
+	hdrs := headers.NewHeaders()
+	_, _, err := hdrs.Parse([]byte(rest))
+	require.NoError(t, err)
+	return hdrs, nonce
+}
+
+func ok(w *response.Writer, r *request.Request) error {
+	_, err := w.Write([]byte("ok"))
+	return err
+}
+
+func TestDefaults(t *testing.T) {
+	h, nonce := serve(t, ok, New())
+	require.NotEmpty(t, nonce)
+	assert.Equal(t, "", h.GetTest(StrictTransportSecurity))
+	assert.Equal(t, strings.ReplaceAll(DefaultCSP, NoncePlaceholder, nonce), h.GetTest(ContentSecurityPolicy))
+	assert.Contains(t, h.GetTest(ContentSecurityPolicy), "'nonce-"+nonce+"'")
+	assert.Equal(t, "nosniff", h.GetTest(XContentTypeOptions))
+	assert.Equal(t, "strict-origin-when-cross-origin", h.GetTest(ReferrerPolicy))
+	assert.Equal(t, "camera=(), microphone=(), geolocation=()", h.GetTest(PermissionsPolicy))
+	assert.Equal(t, "same-origin", h.GetTest(CrossOriginOpenerPolicy))
+	assert.Equal(t, "", h.GetTest(CrossOriginEmbedderPolicy))
+
+	// Test: A fresh nonce per request
+	_, other := serve(t, ok, New())
+	assert.NotEqual(t, nonce, other)
+}
+
+func TestOptions(t *testing.T) {
+	mw := New(
+		WithHSTS(24*time.Hour, false, true),
+		WithCSP("script-src 'nonce-{nonce}' 'strict-dynamic'"),
+		WithReferrerPolicy("no-referrer"),
+		WithPermissionsPolicy(""),
+		WithCOEP("require-corp"),
+		WithHeader("X-Frame-Options", "DENY"),
+	)
+	h, nonce := serve(t, ok, mw)
+	assert.Equal(t, "max-age=86400; preload", h.GetTest(StrictTransportSecurity))
+	assert.Equal(t, "script-src 'nonce-"+nonce+"' 'strict-dynamic'", h.GetTest(ContentSecurityPolicy))
+	assert.Equal(t, "no-referrer", h.GetTest(ReferrerPolicy))
+	assert.Equal(t, "", h.GetTest(PermissionsPolicy))
+	assert.Equal(t, "require-corp", h.GetTest(CrossOriginEmbedderPolicy))
+	assert.Equal(t, "DENY", h.GetTest("X-Frame-Options"))
+}
+
+func TestOverride(t *testing.T) {
+	// Test: Handler sets a header itself
+	h, _ := serve(t, func(w *response.Writer, r *request.Request) error {
+		w.Headers().Set(ReferrerPolicy, "same-origin")
+		return ok(w, r)
+	}, New())
+	assert.Equal(t, "same-origin", h.GetTest(ReferrerPolicy))
+	assert.Equal(t, "nosniff", h.GetTest(XContentTypeOptions))
+
+	// Test: Per route middleware
+	h, nonce := serve(t, ok, New(), Override(WithCOOP(""), WithCSP("img-src 'self'; script-src 'nonce-{nonce}'")))
+	assert.Equal(t, "", h.GetTest(CrossOriginOpenerPolicy))
+	assert.Equal(t, "img-src 'self'; script-src 'nonce-"+nonce+"'", h.GetTest(ContentSecurityPolicy))
+	assert.Equal(t, "nosniff", h.GetTest(XContentTypeOptions))
+
+	// Test: Without New it does nothing
+	h, nonce = serve(t, ok, Override(WithCOOP("same-origin")))
+	assert.Equal(t, "", nonce)
+	assert.Equal(t, "", h.GetTest(CrossOriginOpenerPolicy))
+}
+
+func TestHeaderCase(t *testing.T) {
+	mw := New(
+		WithHeader("content-security-policy", "default-src 'none'"),
+		WithHeader("x-content-type-options", ""),
+	)
+	for range 20 {
+		h, _ := serve(t, ok, mw)
+		assert.Equal(t, "default-src 'none'", h.GetTest(ContentSecurityPolicy))
+		assert.Equal(t, "", h.GetTest(XContentTypeOptions))
+	}
+
+	// Test: Override removes whatever the casing
+	h, _ := serve(t, ok, New(), Override(WithHeader("cross-origin-opener-policy", "")))
+	assert.Equal(t, "", h.GetTest(CrossOriginOpenerPolicy))
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// responseConn is what the response.Writer writes to. It arms the write
+// deadline before every write and cancels the request once a write fails,
+// so a handler that doesn't check its write errors still gets stopped.
+type responseConn struct {
+	conn         net.Conn
+	writeTimeout time.Duration
+	cancel       context.CancelFunc
+
+	started  time.Time
+	deadline time.Time
+	minRate  int
+	grace    time.Duration
+	written  int64
+
+	stopWatch func()
+	hijacked  bool
+}
+
+// start begins the response clock, until then only writeTimeout applies.
+func (c *responseConn) start(timeout time.Duration, minRate int, grace time.Duration) {
+	c.started = time.Now()
+	if timeout > 0 {
+		c.deadline = c.started.Add(timeout)
+	}
+	c.minRate = minRate
+	c.grace = grace
+}
+
+func (c *responseConn) Write(p []byte) (int, error) {
+	c.conn.SetWriteDeadline(c.nextDeadline(time.Now(), len(p)))
+	n, err := c.conn.Write(p)
+	c.written += int64(n)
+	if err != nil {
+		c.cancel()
+	}
+	return n, err
+}
+
+// Hijack stops the server from watching the connection and clears its
+// deadlines. The request context stays alive until the handler returns.
+func (c *responseConn) Hijack() (net.Conn, error) {
+	if c.hijacked {
+		return nil, ErrHijacked
+	}
+	if c.stopWatch != nil {
+		c.stopWatch()
+	}
+	c.conn.SetDeadline(time.Time{})
+	c.writeTimeout = 0
+	c.deadline = time.Time{}
+	c.minRate = 0
+	c.hijacked = true
+	return c.conn, nil
+}
+
+// nextDeadline is the earliest of the per write timeout, the total response
+// deadline and the time by which the client should have read everything
+// written so far plus n at the minimum rate.
+func (c *responseConn) nextDeadline(now time.Time, n int) time.Time {
+	var deadline time.Time
+	earliest := func(t time.Time) {
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+		}
+	}
+
+	if c.writeTimeout > 0 {
+		earliest(now.Add(c.writeTimeout))
+	}
+	if !c.deadline.IsZero() {
+		earliest(c.deadline)
+	}
+	if c.minRate > 0 && !c.started.IsZero() {
+		budget := time.Duration(c.written+int64(n)) * time.Second / time.Duration(c.minRate)
+		earliest(c.started.Add(c.grace + budget))
+	}
+	return deadline
+}
+
+// watchClose cancels the request context once the client goes away.
+// The server never reads past the first request, so whatever the client
+// sends after it is discarded until the read fails.
+// The returned stop func ends the watch and waits for it to finish, it is
+// safe to call more than once.
+func watchClose(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				select {
+				case <-stopped:
+				default:
+					cancel()
+				}
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopped)
+			conn.SetReadDeadline(time.Now())
+			<-done
+		})
+	}
+}
+
+// abort makes the coming Close reset a TCP connection instead of ending it
+// gracefully, so a client reading a half sent response sees an error.
+func abort(conn net.Conn) {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+// HTTPError is an error a handler returns to have it answered with a
+// specific status. Any other error is answered with a 500 that doesn't
+// reveal it.
+type HTTPError struct {
+	Status int
+	// Message is shown to the client, defaults to the reason phrase.
+	Message string
+	// Headers are added to the error response, e.g. Retry-After.
+	Headers headers.Headers
+	// Err is the cause, it is logged but not shown to the client.
+	Err error
+}
+
+func NewError(status int, message string) *HTTPError {
+	return &HTTPError{Status: status, Message: message}
+}
+
+// WrapError returns an HTTPError with status caused by err.
+func WrapError(status int, err error) *HTTPError {
+	return &HTTPError{Status: status, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.message()
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) message() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if text := response.StatusText(e.Status); text != "" {
+		return text
+	}
+	return "Error"
+}
+
+// asHTTPError finds the HTTPError in err or turns err into a bare 500.
+func asHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	return WrapError(response.StatusInternalServerError, err)
+}
+
+// writeError answers err in place of whatever the handler had written. Once
+// the headers are out that is impossible and false is returned, the caller
+// must then abort the connection so the client can tell the response is
+// incomplete.
+func (s *Server) writeError(w *response.Writer, r *request.Request, err error) bool {
+	if w.Reset() != nil {
+		return false
+	}
+	e := asHTTPError(err)
+	for key, vals := range e.Headers {
+		for _, val := range vals {
+			w.Headers().Add(key, val)
+		}
+	}
+	if response.BodyAllowed(e.Status) {
+		err = s.renderError(w, r, e)
+	} else {
+		err = w.WriteStatus(e.Status)
+	}
+	if err != nil {
+		log.Println("error response:", err)
+		if w.Reset() != nil {
+			return false
+		}
+		w.WriteStatus(response.StatusInternalServerError)
+	}
+	return true
+}
+
+// ErrorRenderer writes the response for a handler error. It gets a Writer
+// that has been reset, with the error's headers already set.
+type ErrorRenderer func(w *response.Writer, r *request.Request, e *HTTPError) error
+
+// WithErrorRenderer sets how handler errors are written, defaults to
+// TextErrors.
+func WithErrorRenderer(render ErrorRenderer) Option {
+	return func(s *Server) {
+		s.renderError = render
+	}
+}
+
+// TextErrors writes the error message as plain text.
+func TextErrors(w *response.Writer, r *request.Request, e *HTTPError) error {
+	w.Headers().Set(response.ContentType, "text/plain; charset=utf-8")
+	if err := w.WriteStatus(e.Status); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(e.message() + "\n"))
+	return err
+}
+
+// JSONErrors writes {"status": 404, "error": "Not Found"}.
+func JSONErrors(w *response.Writer, r *request.Request, e *HTTPError) error {
+	body := struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}{e.Status, e.message()}
+	return writeJSONError(w, "application/json", e.Status, body)
+}
+
+// ProblemErrors writes an RFC 9457 problem details object.
+func ProblemErrors(w *response.Writer, r *request.Request, e *HTTPError) error {
+	title := response.StatusText(e.Status)
+	body := struct {
+		Type     string `json:"type"`
+		Title    string `json:"title,omitempty"`
+		Status   int    `json:"status"`
+		Detail   string `json:"detail,omitempty"`
+		Instance string `json:"instance,omitempty"`
+	}{
+		Type:   "about:blank",
+		Title:  title,
+		Status: e.Status,
+	}
+	if msg := e.message(); msg != title {
+		body.Detail = msg
+	}
+	if r != nil && r.RequestLine != nil {
+		body.Instance, _, _ = strings.Cut(r.Target, "?")
+	}
+	return writeJSONError(w, "application/problem+json", e.Status, body)
+}
+
+func writeJSONError(w *response.Writer, contentType string, status int, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	w.Headers().Set(response.ContentType, contentType)
+	if err := w.WriteStatus(status); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yanshuy/http/internal/response"
+)
+
+// LimitPolicy decides what happens to a connection accepted while the
+// server is already at its connection limit.
+type LimitPolicy int
+
+const (
+	// QueueConns stops accepting until a slot frees up, new connections
+	// wait in the listen backlog.
+	QueueConns LimitPolicy = iota
+	// RejectConns accepts the connection and answers 503 right away.
+	RejectConns
+)
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+	rejectTimeout    = time.Second
+)
+
+// WithMaxConns caps the number of connections served at once.
+// Zero means no limit.
+func WithMaxConns(n int, policy LimitPolicy) Option {
+	return func(s *Server) {
+		s.maxConns = n
+		s.limitPolicy = policy
+	}
+}
+
+// WithMaxConnsPerIP caps the number of connections served at once for a
+// single remote IP, connections over the cap are answered with 503.
+// Zero means no limit.
+func WithMaxConnsPerIP(n int) Option {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// Stats is a snapshot of the server's connection counters.
+type Stats struct {
+	Accepted      uint64
+	Active        int64
+	Rejected      uint64
+	RejectedPerIP uint64
+	AcceptErrors  uint64
+}
+
+type counters struct {
+	accepted      atomic.Uint64
+	active        atomic.Int64
+	rejected      atomic.Uint64
+	rejectedPerIP atomic.Uint64
+	acceptErrors  atomic.Uint64
+}
+
+func (s *Server) Stats() Stats {
+	return Stats{
+		Accepted:      s.counters.accepted.Load(),
+		Active:        s.counters.active.Load(),
+		Rejected:      s.counters.rejected.Load(),
+		RejectedPerIP: s.counters.rejectedPerIP.Load(),
+		AcceptErrors:  s.counters.acceptErrors.Load(),
+	}
+}
+
+// connLimiter keeps track of the slots in use, globally and per remote IP.
+type connLimiter struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+// waitSlot blocks until a slot is free when queueing connections.
+// It reports false if the server shuts down in the meantime.
+func (s *Server) waitSlot() bool {
+	if s.maxConns <= 0 || s.limitPolicy != QueueConns {
+		return true
+	}
+	select {
+	case s.limiter.slots <- struct{}{}:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// acquire takes the slots conn needs, waitSlot must have been called before.
+// It reports false if conn was rejected.
+func (s *Server) acquire(conn net.Conn) bool {
+	if s.maxConns > 0 && s.limitPolicy == RejectConns {
+		select {
+		case s.limiter.slots <- struct{}{}:
+		default:
+			s.counters.rejected.Add(1)
+			return false
+		}
+	}
+
+	if s.maxConnsPerIP > 0 {
+		ip := remoteIP(conn)
+		s.limiter.mu.Lock()
+		if s.limiter.perIP[ip] >= s.maxConnsPerIP {
+			s.limiter.mu.Unlock()
+			s.releaseSlot()
+			s.counters.rejectedPerIP.Add(1)
+			return false
+		}
+		s.limiter.perIP[ip]++
+		s.limiter.mu.Unlock()
+	}
+
+	s.counters.active.Add(1)
+	return true
+}
+
+func (s *Server) release(conn net.Conn) {
+	s.counters.active.Add(-1)
+	if s.maxConnsPerIP > 0 {
+		ip := remoteIP(conn)
+		s.limiter.mu.Lock()
+		s.limiter.perIP[ip]--
+		if s.limiter.perIP[ip] <= 0 {
+			delete(s.limiter.perIP, ip)
+		}
+		s.limiter.mu.Unlock()
+	}
+	s.releaseSlot()
+}
+
+func (s *Server) releaseSlot() {
+	if s.maxConns > 0 {
+		<-s.limiter.slots
+	}
+}
+
+// reject answers a quick 503 without reading the request.
+func reject(conn net.Conn) {
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(rejectTimeout))
+	w := response.NewResponseWriter(conn)
+	w.WriteStatus(response.StatusServiceUnavailable)
+	w.Finish()
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func nextBackoff(d time.Duration) time.Duration {
+	if d == 0 {
+		return minAcceptBackoff
+	}
+	return min(2*d, maxAcceptBackoff)
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"io/fs"
 	"log"
 	"net"
-	"net/http"
+	"os"
+	"syscall"
 	"time"
 
 	"github.com/yanshuy/http/internal/request"
@@ -14,72 +17,288 @@ import (
 type Server struct {
 	listener net.Listener
 	Handler
+
+	ctx             context.Context
+	cancel          context.CancelFunc
+	requestTimeout  time.Duration
+	writeTimeout    time.Duration
+	responseTimeout time.Duration
+	minWriteRate    int
+	minRateGrace    time.Duration
+	writeBufSize    int
+	maxConns        int
+	limitPolicy     LimitPolicy
+	maxConnsPerIP   int
+	renderError     ErrorRenderer
+
+	limiter  connLimiter
+	counters counters
 }
 
 type Handler func(w *response.Writer, r *request.Request) error
 
-func Serve(addr string, handler Handler) (*Server, error) {
+// Middleware wraps a Handler with behaviour that runs around it.
+type Middleware func(Handler) Handler
+
+// Chain wraps h with mws, the first middleware is the outermost.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type Option func(*Server)
+
+const defaultWriteTimeout = 10 * time.Second
+
+// WithBaseContext sets the context every request context is derived from.
+// Values stored in ctx are visible to all handlers.
+func WithBaseContext(ctx context.Context) Option {
+	return func(s *Server) {
+		s.ctx = ctx
+	}
+}
+
+// WithRequestTimeout cancels the request context d after the request
+// has been read. Zero means no timeout.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.requestTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds every single write to the client, defaults to 10s.
+// Zero means no timeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// WithResponseTimeout bounds the time spent writing the whole response,
+// measured from the moment the request has been read. Zero means no timeout.
+func WithResponseTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.responseTimeout = d
+	}
+}
+
+// WithMinWriteRate drops clients that read the response slower than
+// bytesPerSec on average, after an initial grace period.
+// Zero means no minimum.
+func WithMinWriteRate(bytesPerSec int, grace time.Duration) Option {
+	return func(s *Server) {
+		s.minWriteRate = bytesPerSec
+		s.minRateGrace = grace
+	}
+}
+
+// WithWriteBufferSize sets how much of a response is buffered before it
+// is sent, defaults to response.DefaultBufferSize. Bodies that fit are
+// sent with a Content-Length, larger ones are chunked.
+func WithWriteBufferSize(n int) Option {
+	return func(s *Server) {
+		s.writeBufSize = n
+	}
+}
+
+// Serve listens on the TCP address addr and serves incoming connections
+// with handler.
+func Serve(addr string, handler Handler, opts ...Option) (*Server, error) {
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	return ServeListener(ln, handler, opts...), nil
+}
+
+// ServeUnix listens on the unix socket at path and serves incoming
+// connections with handler. See ListenUnix for how path and perm are used.
+func ServeUnix(path string, perm fs.FileMode, handler Handler, opts ...Option) (*Server, error) {
+	ln, err := ListenUnix(path, perm)
+	if err != nil {
+		return nil, err
+	}
+	return ServeListener(ln, handler, opts...), nil
+}
 
+// ServeListener serves connections accepted from ln with handler.
+// The server takes ownership of ln and closes it on Close.
+func ServeListener(ln net.Listener, handler Handler, opts ...Option) *Server {
 	server := &Server{
-		listener: ln,
-		Handler:  handler,
+		listener:     ln,
+		Handler:      handler,
+		ctx:          context.Background(),
+		writeTimeout: defaultWriteTimeout,
+		writeBufSize: response.DefaultBufferSize,
+		renderError:  TextErrors,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	server.ctx, server.cancel = context.WithCancel(server.ctx)
+	server.limiter.slots = make(chan struct{}, max(server.maxConns, 0))
+	server.limiter.perIP = make(map[string]int)
 
 	go server.listen()
 
-	return server, nil
+	return server
+}
+
+// ListenUnix creates a unix socket listener at path with file mode perm.
+// A stale socket left behind at path by a previous process is removed first,
+// a socket something still listens on or any other kind of file at path is
+// an error.
+func ListenUnix(path string, perm fs.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, ErrNotSocket
+		}
+		// only a socket nobody listens on refuses connections
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, ErrSocketInUse
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, ErrSocketInUse
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
 }
 
 func (s *Server) listen() {
+	var backoff time.Duration
 	for {
+		if !s.waitSlot() {
+			return
+		}
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if s.limitPolicy == QueueConns {
+				s.releaseSlot()
+			}
 			if errors.Is(err, net.ErrClosed) {
 				return
 			}
-			log.Println("accept error:", err)
-			time.Sleep(100 * time.Millisecond)
+			s.counters.acceptErrors.Add(1)
+			backoff = nextBackoff(backoff)
+			log.Println("accept error:", err, "retrying in", backoff)
+			time.Sleep(backoff)
 			continue
 		}
+		backoff = 0
+		s.counters.accepted.Add(1)
 		log.Println("connection accepted from", conn.RemoteAddr())
-		go s.handleConnection(conn)
+
+		if !s.acquire(conn) {
+			go reject(conn)
+			continue
+		}
+		go func() {
+			defer s.release(conn)
+			s.handleConnection(conn)
+		}()
 	}
 }
 
+// Close stops accepting connections and cancels the context of every
+// request still in flight.
 func (s *Server) Close() error {
+	s.cancel()
 	return s.listener.Close()
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	respConn := &responseConn{
+		conn:         conn,
+		writeTimeout: s.writeTimeout,
+		cancel:       cancel,
+	}
+	defer func() {
+		if !respConn.hijacked {
+			conn.Close()
+		}
+	}()
 
 	const readTimeout = 5 * time.Second
 	conn.SetReadDeadline(time.Now().Add(readTimeout))
 
-	respWriter := response.NewResponseWriter(conn)
+	respWriter := response.NewResponseWriterSize(respConn, s.writeBufSize)
 	req, err := request.RequestFromReader(conn)
 	if err != nil {
 		if ne, ok := err.(net.Error); ok && ne.Timeout() {
-			respWriter.WriteStatus(http.StatusRequestTimeout)
+			respWriter.WriteStatus(response.StatusRequestTimeout)
 			respWriter.Finish()
 			return
 		}
 		log.Println("request: ", err)
-		respWriter.WriteStatus(http.StatusBadRequest)
+		if errors.Is(err, request.ErrBodyTooLarge) {
+			respWriter.WriteStatus(response.StatusContentTooLarge)
+			respWriter.Finish()
+			return
+		}
+		respWriter.WriteStatus(response.StatusBadRequest)
 		respWriter.Finish()
 		return
 	}
 
-	if err := s.Handler(respWriter, req); err != nil {
+	conn.SetReadDeadline(time.Time{})
+	respConn.start(s.responseTimeout, s.minWriteRate, s.minRateGrace)
+	respConn.stopWatch = watchClose(conn, cancel)
+	defer respConn.stopWatch()
+
+	if s.requestTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancelTimeout()
+	}
+	respWriter.SetRequestMethod(req.Method)
+	req.RemoteAddr = conn.RemoteAddr().String()
+	req = req.WithContext(ctx)
+
+	err = s.Handler(respWriter, req)
+	if respWriter.Hijacked() {
+		if err != nil {
+			log.Println("handler:", err)
+		}
+		return
+	}
+	if err != nil {
 		log.Println("handler:", err)
-		respWriter.WriteStatus(http.StatusInternalServerError)
+		if !s.writeError(respWriter, req, err) {
+			abort(conn)
+			return
+		}
 	}
 
 	if err := respWriter.Finish(); err != nil {
 		log.Println("error writing response: ", err)
 	}
 }
+
+var (
+	ErrNotSocket   = errors.New("file exists and is not a socket")
+	ErrSocketInUse = errors.New("address in use")
+	ErrHijacked    = errors.New("connection already hijacked")
+)
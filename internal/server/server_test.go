@@ -1 +1,452 @@
 package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/headers"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+// pipeListener is an in-memory net.Listener, every Dial hands one end of a
+// net.Pipe to Accept
+type pipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+func (l *pipeListener) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func roundTrip(t *testing.T, conn net.Conn, raw string) string {
+	t.Helper()
+	defer conn.Close()
+	_, err := io.WriteString(conn, raw)
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(resp)
+}
+
+func echoTarget(w *response.Writer, r *request.Request) error {
+	_, err := w.Write([]byte(r.Target))
+	return err
+}
+
+func TestServeListener(t *testing.T) {
+	ln := newPipeListener()
+	s := ServeListener(ln, echoTarget)
+	defer s.Close()
+
+	conn, err := ln.Dial()
+	require.NoError(t, err)
+	resp := roundTrip(t, conn, "GET /pipe HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "content-length: 5\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n/pipe"))
+
+	// Test: Malformed request line
+	conn, err = ln.Dial()
+	require.NoError(t, err)
+	resp = roundTrip(t, conn, "GET /pipe\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+
+	// Test: Body over the limit
+	conn, err = ln.Dial()
+	require.NoError(t, err)
+	resp = roundTrip(t, conn, fmt.Sprintf("POST /pipe HTTP/1.1\r\nContent-Length: %d\r\n\r\n", request.MaxBodySize+1))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: Closed listener
+	require.NoError(t, s.Close())
+	_, err = ln.Dial()
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestWriteBufferSize(t *testing.T) {
+	body := strings.Repeat("x", 5000)
+	h := func(w *response.Writer, r *request.Request) error {
+		_, err := w.Write([]byte(body))
+		return err
+	}
+	get := func(opts ...Option) string {
+		ln := newPipeListener()
+		s := ServeListener(ln, h, opts...)
+		defer s.Close()
+		conn, err := ln.Dial()
+		require.NoError(t, err)
+		return roundTrip(t, conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	}
+
+	resp := get()
+	assert.Contains(t, resp, "transfer-encoding: chunked\r\n")
+	assert.NotContains(t, resp, "content-length")
+
+	// Test: Body fits in a larger buffer
+	resp = get(WithWriteBufferSize(8192))
+	assert.Contains(t, resp, "content-length: 5000\r\n")
+	assert.NotContains(t, resp, "transfer-encoding")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"+body))
+}
+
+func TestServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+	s, err := ServeUnix(path, 0600, echoTarget)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	resp := roundTrip(t, conn, "GET /unix HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "content-length: 5\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n/unix"))
+	require.NoError(t, s.Close())
+
+	// Test: Stale socket is replaced
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	s, err = ServeUnix(path, 0660, echoTarget)
+	require.NoError(t, err)
+
+	// Test: Live socket is left alone
+	_, err = ListenUnix(path, 0660)
+	assert.Equal(t, ErrSocketInUse, err)
+	conn, err = net.Dial("unix", path)
+	require.NoError(t, err)
+	resp = roundTrip(t, conn, "GET /unix HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	s.Close()
+
+	// Test: Regular file is left alone
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	_, err = ListenUnix(file, 0600)
+	assert.Equal(t, ErrNotSocket, err)
+}
+
+func TestRequestContext(t *testing.T) {
+	type ctxKey struct{}
+	errs := make(chan error, 1)
+	waitDone := func(w *response.Writer, r *request.Request) error {
+		assert.Equal(t, "base", r.Context().Value(ctxKey{}))
+		<-r.Context().Done()
+		errs <- r.Context().Err()
+		return nil
+	}
+	base := context.WithValue(context.Background(), ctxKey{}, "base")
+
+	// Test: Client disconnect cancels the context
+	ln := newPipeListener()
+	s := ServeListener(ln, waitDone, WithBaseContext(base))
+	defer s.Close()
+	conn, err := ln.Dial()
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, context.Canceled, <-errs)
+
+	// Test: Request timeout
+	ln = newPipeListener()
+	s = ServeListener(ln, waitDone, WithBaseContext(base), WithRequestTimeout(10*time.Millisecond))
+	defer s.Close()
+	conn, err = ln.Dial()
+	require.NoError(t, err)
+	resp := roundTrip(t, conn, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, context.DeadlineExceeded, <-errs)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Server shutdown
+	ln = newPipeListener()
+	s = ServeListener(ln, waitDone, WithBaseContext(base))
+	conn, err = ln.Dial()
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.Close())
+	assert.Equal(t, context.Canceled, <-errs)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	errs := make(chan error, 1)
+	ln := newPipeListener()
+	s := ServeListener(ln, func(w *response.Writer, r *request.Request) error {
+		var err error
+		for err == nil {
+			_, err = w.Write([]byte("never read"))
+		}
+		assert.Equal(t, err, w.Err())
+		assert.Equal(t, context.Canceled, r.Context().Err())
+		errs <- err
+		return nil
+	}, WithWriteTimeout(10*time.Millisecond))
+	defer s.Close()
+
+	conn, err := ln.Dial()
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	assert.ErrorIs(t, <-errs, os.ErrDeadlineExceeded)
+}
+
+func TestWriteDeadline(t *testing.T) {
+	now := time.Now()
+	c := &responseConn{writeTimeout: time.Second}
+	assert.Equal(t, now.Add(time.Second), c.nextDeadline(now, 100))
+
+	// Test: Total response deadline comes first
+	c.start(500*time.Millisecond, 0, 0)
+	c.started = now
+	c.deadline = now.Add(500 * time.Millisecond)
+	assert.Equal(t, now.Add(500*time.Millisecond), c.nextDeadline(now, 100))
+
+	// Test: Minimum rate budget grows with the bytes written
+	c = &responseConn{writeTimeout: time.Minute}
+	c.start(0, 1000, time.Second)
+	c.started = now
+	assert.Equal(t, now.Add(time.Second+100*time.Millisecond), c.nextDeadline(now, 100))
+	c.written = 2000
+	assert.Equal(t, now.Add(3*time.Second+100*time.Millisecond), c.nextDeadline(now, 100))
+}
+
+// flakyListener fails the first n Accept calls
+type flakyListener struct {
+	*pipeListener
+	n atomic.Int32
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.n.Add(-1) >= 0 {
+		return nil, errors.New("too many open files")
+	}
+	return l.pipeListener.Accept()
+}
+
+func TestConnLimits(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	block := func(w *response.Writer, r *request.Request) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	// Test: Reject over the limit
+	ln := newPipeListener()
+	s := ServeListener(ln, block, WithMaxConns(1, RejectConns))
+	defer s.Close()
+	first, err := ln.Dial()
+	require.NoError(t, err)
+	go roundTrip(t, first, "GET / HTTP/1.1\r\n\r\n")
+	<-started
+	conn, err := ln.Dial()
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 503 Service Unavailable\r\n"))
+	assert.Equal(t, uint64(1), s.Stats().Rejected)
+	assert.Equal(t, int64(1), s.Stats().Active)
+	release <- struct{}{}
+
+	// Test: Queue over the limit
+	ln = newPipeListener()
+	s = ServeListener(ln, block, WithMaxConns(1, QueueConns))
+	defer s.Close()
+	first, err = ln.Dial()
+	require.NoError(t, err)
+	go roundTrip(t, first, "GET / HTTP/1.1\r\n\r\n")
+	<-started
+	dialed := make(chan net.Conn)
+	go func() {
+		conn, _ := ln.Dial()
+		dialed <- conn
+	}()
+	select {
+	case <-dialed:
+		t.Fatal("accepted over the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release <- struct{}{}
+	conn = <-dialed
+	go roundTrip(t, conn, "GET / HTTP/1.1\r\n\r\n")
+	<-started
+	release <- struct{}{}
+	assert.Equal(t, uint64(0), s.Stats().Rejected)
+
+	// Test: Per IP limit
+	ln = newPipeListener()
+	s = ServeListener(ln, block, WithMaxConnsPerIP(1))
+	defer s.Close()
+	first, err = ln.Dial()
+	require.NoError(t, err)
+	go roundTrip(t, first, "GET / HTTP/1.1\r\n\r\n")
+	<-started
+	conn, err = ln.Dial()
+	require.NoError(t, err)
+	resp, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 503 Service Unavailable\r\n"))
+	assert.Equal(t, uint64(1), s.Stats().RejectedPerIP)
+	release <- struct{}{}
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	ln := &flakyListener{pipeListener: newPipeListener()}
+	ln.n.Store(3)
+	s := ServeListener(ln, echoTarget)
+	defer s.Close()
+
+	conn, err := ln.Dial()
+	require.NoError(t, err)
+	resp := roundTrip(t, conn, "GET /ok HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Equal(t, uint64(3), s.Stats().AcceptErrors)
+	assert.Equal(t, uint64(1), s.Stats().Accepted)
+
+	assert.Equal(t, minAcceptBackoff, nextBackoff(0))
+	assert.Equal(t, 2*minAcceptBackoff, nextBackoff(minAcceptBackoff))
+	assert.Equal(t, maxAcceptBackoff, nextBackoff(maxAcceptBackoff))
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, r *request.Request) error {
+				order = append(order, name)
+				return next(w, r)
+			}
+		}
+	}
+	h := Chain(func(w *response.Writer, r *request.Request) error {
+		order = append(order, r.RemoteAddr)
+		return nil
+	}, mw("outer"), mw("inner"))
+
+	ln := newPipeListener()
+	s := ServeListener(ln, h)
+	defer s.Close()
+	conn, err := ln.Dial()
+	require.NoError(t, err)
+	roundTrip(t, conn, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, []string{"outer", "inner", "pipe"}, order)
+}
+
+func TestHandlerErrors(t *testing.T) {
+	get := "GET /things/1?x=y HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	serve := func(h Handler, opts ...Option) string {
+		ln := newPipeListener()
+		s := ServeListener(ln, h, opts...)
+		defer s.Close()
+		conn, err := ln.Dial()
+		require.NoError(t, err)
+		return roundTrip(t, conn, get)
+	}
+
+	// Test: Plain error replaces the partial body with a 500
+	resp := serve(func(w *response.Writer, r *request.Request) error {
+		w.Headers().Set("X-Kept", "yes")
+		w.Headers().Set(response.ETag, `"v1"`)
+		w.Headers().Set(response.LastModified, "Sun, 18 Oct 2026 10:00:00 GMT")
+		w.Write([]byte("half a resp"))
+		return errors.New("database is down")
+	})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.Contains(t, resp, "x-kept: yes\r\n")
+	assert.NotContains(t, resp, "etag")
+	assert.NotContains(t, resp, "last-modified")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nInternal Server Error\n"))
+	assert.NotContains(t, resp, "database")
+
+	// Test: HTTPError status, message and headers
+	notFound := func(w *response.Writer, r *request.Request) error {
+		e := NewError(response.StatusNotFound, "no such thing")
+		e.Headers = headers.NewHeaders()
+		e.Headers.Set("Retry-After", "5")
+		return fmt.Errorf("lookup: %w", e)
+	}
+	resp = serve(notFound)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+	assert.Contains(t, resp, "retry-after: 5\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nno such thing\n"))
+
+	// Test: JSON renderer
+	resp = serve(notFound, WithErrorRenderer(JSONErrors))
+	assert.Contains(t, resp, "content-type: application/json\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n{\"status\":404,\"error\":\"no such thing\"}\n"))
+
+	// Test: Problem details renderer
+	resp = serve(notFound, WithErrorRenderer(ProblemErrors))
+	assert.Contains(t, resp, "content-type: application/problem+json\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"+
+		`{"type":"about:blank","title":"Not Found","status":404,"detail":"no such thing","instance":"/things/1"}`+"\n"))
+
+	// Test: Error after the headers went out cuts the response short
+	resp = serve(func(w *response.Writer, r *request.Request) error {
+		w.Write([]byte("streamed"))
+		w.Flush()
+		return errors.New("stream broke")
+	})
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "8\r\nstreamed\r\n"))
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// codec turns cookie payloads into "payload.mac" values and back. The
+// first key of each list is used to sign and encrypt, the others are
+// still accepted so keys can be rotated without logging everyone out.
+type codec struct {
+	name     string
+	signKeys [][]byte
+	aeads    []cipher.AEAD
+}
+
+func newAEADs(keys [][]byte) ([]cipher.AEAD, error) {
+	aeads := make([]cipher.AEAD, 0, len(keys))
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads = append(aeads, aead)
+	}
+	return aeads, nil
+}
+
+func (c *codec) encode(data []byte) (string, error) {
+	if len(c.aeads) > 0 {
+		aead := c.aeads[0]
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		data = aead.Seal(nonce, nonce, data, []byte(c.name))
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.mac(c.signKeys[0], payload)), nil
+}
+
+func (c *codec) decode(value string) ([]byte, error) {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	if !c.verify(payload, mac) {
+		return nil, ErrInvalidCookie
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	if len(c.aeads) == 0 {
+		return data, nil
+	}
+	for _, aead := range c.aeads {
+		if len(data) < aead.NonceSize() {
+			break
+		}
+		nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+		if plain, err := aead.Open(nil, nonce, sealed, []byte(c.name)); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+func (c *codec) verify(payload string, mac []byte) bool {
+	for _, key := range c.signKeys {
+		if hmac.Equal(mac, c.mac(key, payload)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mac covers the cookie name too, so a value can't be moved to another
+// cookie signed with the same key
+func (c *codec) mac(key []byte, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(c.name + "=" + payload))
+	return h.Sum(nil)
+}
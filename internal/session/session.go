@@ -0,0 +1,351 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yanshuy/http/internal/cookie"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const (
+	defaultCookieName      = "session"
+	defaultIdleTimeout     = 30 * time.Minute
+	defaultAbsoluteTimeout = 24 * time.Hour
+	// touchInterval is how stale the last seen time may get before an
+	// otherwise unchanged session is saved again to push its idle expiry.
+	touchInterval = time.Minute
+)
+
+// Session is the session of the client making a request. It is safe for
+// concurrent use. Changes made after the response headers went out are
+// not saved.
+type Session struct {
+	mu        sync.Mutex
+	rec       *Record
+	isNew     bool
+	changed   bool
+	destroyed bool
+	// oldID is the ID replaced by Regenerate, deleted from the store on save
+	oldID string
+}
+
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rec.ID
+}
+
+// IsNew reports whether the client had no valid session before this
+// request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+func (s *Session) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.rec.Values[key]
+	return val, ok
+}
+
+func (s *Session) Set(key, val string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rec.Values == nil {
+		s.rec.Values = make(map[string]string)
+	}
+	s.rec.Values[key] = val
+	s.changed = true
+	s.destroyed = false
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rec.Values, key)
+	s.changed = true
+}
+
+// Regenerate gives the session a new ID and keeps its values. Call it
+// whenever the privilege level changes, e.g. on login, so an ID planted
+// by an attacker before is worthless.
+func (s *Session) Regenerate() error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.rec.ID
+	}
+	s.rec.ID = id
+	s.changed = true
+	return nil
+}
+
+// Destroy drops all values and removes the session from the client and
+// the store, e.g. on logout.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rec.Values = nil
+	s.destroyed = true
+}
+
+type ctxKey struct{}
+
+// FromRequest returns the session of r, nil if the middleware isn't
+// installed.
+func FromRequest(r *request.Request) *Session {
+	s, _ := r.Context().Value(ctxKey{}).(*Session)
+	return s
+}
+
+type manager struct {
+	codec           codec
+	encryptionKeys  [][]byte
+	cookie          cookie.Cookie
+	store           Store
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	now             func() time.Time
+}
+
+type Option func(*manager)
+
+// WithOldKeys adds signing keys that are still accepted but no longer
+// used to sign, for key rotation.
+func WithOldKeys(keys ...[]byte) Option {
+	return func(m *manager) {
+		m.codec.signKeys = append(m.codec.signKeys, keys...)
+	}
+}
+
+// WithEncryption encrypts cookies with AES-GCM under key, which must be
+// 16, 24 or 32 bytes long. Cookies encrypted with one of old are still
+// read.
+func WithEncryption(key []byte, old ...[]byte) Option {
+	return func(m *manager) {
+		m.encryptionKeys = append([][]byte{key}, old...)
+	}
+}
+
+// WithCookie sets the name and attributes of the session cookie, its
+// Value, Expires and MaxAge are ignored. Defaults to "session" with
+// Path=/, HttpOnly and SameSite=Lax.
+func WithCookie(c cookie.Cookie) Option {
+	return func(m *manager) {
+		m.cookie = c
+	}
+}
+
+// WithStore keeps session data in store instead of the cookie itself.
+func WithStore(store Store) Option {
+	return func(m *manager) {
+		m.store = store
+	}
+}
+
+// WithIdleTimeout expires sessions not used for d, defaults to 30 minutes.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(m *manager) {
+		m.idleTimeout = d
+	}
+}
+
+// WithAbsoluteTimeout expires sessions d after they were created no
+// matter how active they are, defaults to 24 hours.
+func WithAbsoluteTimeout(d time.Duration) Option {
+	return func(m *manager) {
+		m.absoluteTimeout = d
+	}
+}
+
+// New returns a middleware that makes the client's session available
+// through FromRequest. The session cookie is signed with HMAC-SHA256
+// under signingKey. It panics if signingKey is empty or an encryption key
+// has an invalid size.
+func New(signingKey []byte, opts ...Option) server.Middleware {
+	if len(signingKey) == 0 {
+		panic("session: empty signing key")
+	}
+	m := &manager{
+		codec: codec{signKeys: [][]byte{signingKey}},
+		cookie: cookie.Cookie{
+			Name:     defaultCookieName,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: cookie.SameSiteLax,
+		},
+		idleTimeout:     defaultIdleTimeout,
+		absoluteTimeout: defaultAbsoluteTimeout,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	aeads, err := newAEADs(m.encryptionKeys)
+	if err != nil {
+		panic("session: " + err.Error())
+	}
+	m.codec.aeads = aeads
+	m.codec.name = m.cookie.Name
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, r *request.Request) error {
+			now := m.now()
+			s := m.load(r, now)
+			w.OnWriteHeaders(func(w *response.Writer) {
+				if err := m.save(w, s, now); err != nil {
+					log.Println("session:", err)
+				}
+			})
+			return next(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, s)))
+		}
+	}
+}
+
+// load returns the session of r, or a new one when there is no valid one.
+func (m *manager) load(r *request.Request, now time.Time) *Session {
+	if c, err := cookie.Get(r, m.cookie.Name); err == nil {
+		if rec, err := m.decode(c.Value, now); err != nil {
+			log.Println("session:", err)
+		} else if rec != nil && !m.expired(rec, now) {
+			return &Session{rec: rec}
+		} else if rec != nil && m.store != nil {
+			m.store.Delete(rec.ID)
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		// without randomness no session can be safe, leave it unusable
+		log.Println("session:", err)
+	}
+	return &Session{
+		rec:   &Record{ID: id, Created: now, Seen: now},
+		isNew: true,
+	}
+}
+
+// decode returns the record a cookie value refers to, nil for an invalid
+// or unknown session.
+func (m *manager) decode(value string, now time.Time) (*Record, error) {
+	data, err := m.codec.decode(value)
+	if err != nil {
+		return nil, nil
+	}
+	if m.store != nil {
+		return m.store.Load(string(data), now)
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (m *manager) expired(rec *Record, now time.Time) bool {
+	return !now.Before(m.expires(rec))
+}
+
+func (m *manager) expires(rec *Record) time.Time {
+	expires := rec.Created.Add(m.absoluteTimeout)
+	if idle := rec.Seen.Add(m.idleTimeout); idle.Before(expires) {
+		expires = idle
+	}
+	return expires
+}
+
+// save persists s and sends its cookie, if anything needs saving.
+func (m *manager) save(w *response.Writer, s *Session, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.destroyed {
+		if m.store != nil {
+			m.store.Delete(s.rec.ID)
+			if s.oldID != "" {
+				m.store.Delete(s.oldID)
+			}
+		}
+		if s.isNew {
+			return nil
+		}
+		return cookie.Set(w, m.sessionCookie("", -1))
+	}
+	if !s.changed && (s.isNew || now.Sub(s.rec.Seen) < touchInterval) {
+		return nil
+	}
+	if s.rec.ID == "" {
+		return ErrNoID
+	}
+
+	s.rec.Seen = now
+	expires := m.expires(s.rec)
+	var data []byte
+	if m.store != nil {
+		if s.oldID != "" {
+			if err := m.store.Delete(s.oldID); err != nil {
+				return err
+			}
+		}
+		if err := m.store.Save(s.rec, expires); err != nil {
+			return err
+		}
+		data = []byte(s.rec.ID)
+	} else {
+		var err error
+		if data, err = json.Marshal(s.rec); err != nil {
+			return err
+		}
+	}
+
+	value, err := m.codec.encode(data)
+	if err != nil {
+		return err
+	}
+	if len(value) > maxCookieSize {
+		return ErrTooLarge
+	}
+	maxAge := int(expires.Sub(now).Round(time.Second) / time.Second)
+	return cookie.Set(w, m.sessionCookie(value, max(maxAge, 1)))
+}
+
+func (m *manager) sessionCookie(value string, maxAge int) *cookie.Cookie {
+	c := m.cookie
+	c.Value = value
+	c.Expires = time.Time{}
+	c.MaxAge = maxAge
+	return &c
+}
+
+// maxCookieSize is what browsers are required to store at least,
+// RFC 6265 section 6.1
+const maxCookieSize = 4096
+
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+var (
+	ErrInvalidCookie = errors.New("session: invalid cookie")
+	ErrTooLarge      = errors.New("session: cookie too large, use a store")
+	ErrNoID          = errors.New("session: no session id")
+)
@@ -0,0 +1,161 @@
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// client keeps the session cookie between requests like a browser would
+type client struct {
+	t      *testing.T
+	mw     server.Middleware
+	cookie string
+}
+
+// do runs h behind the middleware and returns the Set-Cookie line, if any
+func (c *client) do(h server.Handler) string {
+	c.t.Helper()
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "GET", Target: "/", HttpVersion: "1.1"}
+	if c.cookie != "" {
+		r.Headers.Set("Cookie", c.cookie)
+	}
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	require.NoError(c.t, c.mw(h)(w, r))
+	require.NoError(c.t, w.Finish())
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if val, ok := strings.CutPrefix(line, "set-cookie: "); ok {
+			pair, _, _ := strings.Cut(val, ";")
+			if strings.Contains(val, "Max-Age=0") {
+				c.cookie = ""
+			} else {
+				c.cookie = pair
+			}
+			return val
+		}
+	}
+	return ""
+}
+
+func setUser(w *response.Writer, r *request.Request) error {
+	FromRequest(r).Set("user", "alice")
+	return nil
+}
+
+func getUser(t *testing.T, want string) server.Handler {
+	return func(w *response.Writer, r *request.Request) error {
+		got, _ := FromRequest(r).Get("user")
+		assert.Equal(t, want, got)
+		return nil
+	}
+}
+
+func noop(w *response.Writer, r *request.Request) error {
+	return nil
+}
+
+func TestCookieSession(t *testing.T) {
+	c := &client{t: t, mw: New(key)}
+
+	// Test: Untouched new session sets no cookie
+	assert.Equal(t, "", c.do(noop))
+
+	line := c.do(setUser)
+	assert.True(t, strings.HasPrefix(line, "session="))
+	assert.Contains(t, line, "Path=/; Max-Age=1800; HttpOnly; SameSite=Lax")
+	c.do(getUser(t, "alice"))
+
+	// Test: Tampered cookie starts over
+	good := c.cookie
+	c.cookie = strings.Replace(good, "=", "=x", 1)
+	c.do(getUser(t, ""))
+
+	// Test: Key rotation keeps old cookies valid
+	c.cookie = good
+	c.mw = New([]byte("new key"), WithOldKeys(key))
+	c.do(getUser(t, "alice"))
+	c.mw = New([]byte("new key"))
+	c.do(getUser(t, ""))
+}
+
+func TestEncryptedSession(t *testing.T) {
+	c := &client{t: t, mw: New(key, WithEncryption(key[:16]))}
+	c.do(setUser)
+	assert.NotContains(t, c.cookie, "YWxpY2") // base64 of "alic"
+	c.do(getUser(t, "alice"))
+
+	newKey := []byte("fedcba9876543210")
+	c.mw = New(key, WithEncryption(newKey, key[:16]))
+	c.do(getUser(t, "alice"))
+	c.mw = New(key, WithEncryption(newKey))
+	c.do(getUser(t, ""))
+
+	assert.Panics(t, func() { New(key, WithEncryption([]byte("short"))) })
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	clock := func(m *manager) { m.now = func() time.Time { return now } }
+	c := &client{t: t, mw: New(key, clock, WithIdleTimeout(10*time.Minute), WithAbsoluteTimeout(time.Hour))}
+	c.do(setUser)
+
+	// Test: Activity within the idle timeout keeps the session alive
+	for range 6 {
+		now = now.Add(9 * time.Minute)
+		c.do(getUser(t, "alice"))
+	}
+
+	// Test: Absolute timeout ends it anyway
+	now = now.Add(9 * time.Minute)
+	c.do(getUser(t, ""))
+
+	// Test: Idle timeout
+	c.cookie = ""
+	c.do(setUser)
+	now = now.Add(11 * time.Minute)
+	c.do(getUser(t, ""))
+}
+
+func TestStoreSession(t *testing.T) {
+	store := NewMemoryStore()
+	c := &client{t: t, mw: New(key, WithStore(store))}
+	c.do(setUser)
+	assert.Equal(t, 1, store.Len())
+	c.do(getUser(t, "alice"))
+
+	// Test: Regenerate moves the data to a new ID
+	var oldID, newID string
+	c.do(func(w *response.Writer, r *request.Request) error {
+		s := FromRequest(r)
+		oldID = s.ID()
+		require.NoError(t, s.Regenerate())
+		newID = s.ID()
+		return nil
+	})
+	assert.NotEqual(t, oldID, newID)
+	assert.Equal(t, 1, store.Len())
+	rec, err := store.Load(newID, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "alice", rec.Values["user"])
+	c.do(getUser(t, "alice"))
+
+	// Test: Destroy clears store and cookie
+	line := c.do(func(w *response.Writer, r *request.Request) error {
+		FromRequest(r).Destroy()
+		return nil
+	})
+	assert.Contains(t, line, "Max-Age=0")
+	assert.Equal(t, 0, store.Len())
+}
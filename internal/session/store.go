@@ -0,0 +1,96 @@
+package session
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// Record is what is persisted of a session.
+type Record struct {
+	ID      string            `json:"id"`
+	Values  map[string]string `json:"v,omitempty"`
+	Created time.Time         `json:"c"`
+	Seen    time.Time         `json:"s"`
+}
+
+func (rec *Record) clone() *Record {
+	c := *rec
+	c.Values = maps.Clone(rec.Values)
+	return &c
+}
+
+// Store keeps sessions on the server, the cookie then only carries the
+// signed session ID.
+type Store interface {
+	// Load returns the record saved under id, nil if there is none or it
+	// has expired by now.
+	Load(id string, now time.Time) (*Record, error)
+	Save(rec *Record, expires time.Time) error
+	Delete(id string) error
+}
+
+const sweepInterval = time.Minute
+
+type entry struct {
+	rec     *Record
+	expires time.Time
+}
+
+// MemoryStore keeps sessions in memory, they are lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]entry),
+	}
+}
+
+func (s *MemoryStore) Load(id string, now time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+	e, ok := s.entries[id]
+	if !ok || !now.Before(e.expires) {
+		return nil, nil
+	}
+	return e.rec.clone(), nil
+}
+
+func (s *MemoryStore) Save(rec *Record, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[rec.ID] = entry{rec.clone(), expires}
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones not
+// swept yet.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for id, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, id)
+		}
+	}
+	s.lastSweep = now
+}
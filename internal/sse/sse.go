@@ -0,0 +1,149 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+const (
+	ContentType  = "text/event-stream"
+	CacheControl = "Cache-Control"
+	LastEventID  = "Last-Event-ID"
+)
+
+// Event is one server-sent event. Empty fields are left out.
+type Event struct {
+	ID    string
+	Event string
+	// Data is split into one data field per line.
+	Data  string
+	Retry time.Duration
+}
+
+// Writer streams events over a chunked response, each event is flushed
+// to the client as its own chunk. It is safe for concurrent use.
+type Writer struct {
+	w           *response.Writer
+	ctx         context.Context
+	lastEventID string
+
+	mu sync.Mutex
+}
+
+// NewWriter turns the response into an event stream. Nothing is written
+// before the first event or comment.
+func NewWriter(w *response.Writer, r *request.Request) (*Writer, error) {
+	h := w.Headers()
+	h.Set(response.ContentType, ContentType)
+	h.Set(CacheControl, "no-cache")
+	h.Del(response.ContentLength)
+	if err := w.WriteStatus(response.StatusOK); err != nil {
+		return nil, err
+	}
+
+	lastEventID, _ := r.Headers.Get(LastEventID)
+	return &Writer{
+		w:           w,
+		ctx:         r.Context(),
+		lastEventID: lastEventID,
+	}, nil
+}
+
+// LastEventID is the ID of the last event a reconnecting client saw,
+// the stream should resume right after it. Empty on the first connection.
+func (s *Writer) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed once the client has gone away.
+func (s *Writer) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *Writer) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return ErrInvalidField
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	if e.Data != "" {
+		data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			b.WriteString("data: " + line + "\n")
+		}
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment sends a comment line, clients ignore it.
+func (s *Writer) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Heartbeat sends an empty comment every interval so that proxies don't
+// drop an idle stream and a gone client is noticed by the next write.
+// It stops when the client disconnects, a write fails or stop is called.
+func (s *Writer) Heartbeat(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.write(":\n\n"); err != nil {
+					return
+				}
+			case <-done:
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+func (s *Writer) write(event string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write([]byte(event)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+var ErrInvalidField = errors.New("sse: id and event must be single line")
@@ -0,0 +1,80 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+func newStream(t *testing.T, ctx context.Context, lastEventID string) (*Writer, *response.Writer, *bytes.Buffer) {
+	t.Helper()
+	r := request.NewRequest()
+	r.RequestLine = &request.RequestLine{Method: "GET", Target: "/events", HttpVersion: "1.1"}
+	if lastEventID != "" {
+		r.Headers.Set(LastEventID, lastEventID)
+	}
+	var buf bytes.Buffer
+	w := response.NewResponseWriter(&buf)
+	s, err := NewWriter(w, r.WithContext(ctx))
+	require.NoError(t, err)
+	return s, w, &buf
+}
+
+func TestSend(t *testing.T) {
+	s, w, buf := newStream(t, context.Background(), "41")
+	assert.Equal(t, "41", s.LastEventID())
+
+	require.NoError(t, s.Send(Event{ID: "42", Event: "update", Data: "line one\r\nline two", Retry: 3 * time.Second}))
+	require.NoError(t, s.Send(Event{Data: "plain"}))
+	require.NoError(t, s.Comment("hi"))
+	require.NoError(t, w.Finish())
+
+	resp := buf.String()
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "content-type: text/event-stream\r\n")
+	assert.Contains(t, resp, "cache-control: no-cache\r\n")
+	assert.Contains(t, resp, "transfer-encoding: chunked\r\n")
+
+	event := "id: 42\nevent: update\nretry: 3000\ndata: line one\ndata: line two\n\n"
+	assert.Contains(t, resp, event+"\r\n")
+	assert.Contains(t, resp, "data: plain\n\n\r\n")
+	assert.Contains(t, resp, ": hi\n\n\r\n")
+
+	assert.Equal(t, ErrInvalidField, s.Send(Event{ID: "4\n2"}))
+}
+
+func TestClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, _, _ := newStream(t, ctx, "")
+	cancel()
+	<-s.Done()
+	assert.Equal(t, context.Canceled, s.Send(Event{Data: "lost"}))
+}
+
+func TestHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, _, buf := newStream(t, ctx, "")
+
+	stop := s.Heartbeat(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	stop()
+	assert.Contains(t, buf.String(), "3\r\n:\n\n\r\n")
+
+	// Test: Stops with the client
+	s, _, buf = newStream(t, ctx, "")
+	stop = s.Heartbeat(time.Millisecond)
+	cancel()
+	stop()
+	n := buf.Len()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, n, buf.Len())
+}
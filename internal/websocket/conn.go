@@ -0,0 +1,421 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type MessageType int
+
+const (
+	continuationFrame MessageType = 0
+	TextMessage       MessageType = 1
+	BinaryMessage     MessageType = 2
+	CloseMessage      MessageType = 8
+	PingMessage       MessageType = 9
+	PongMessage       MessageType = 10
+)
+
+// Close codes from RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+const (
+	finBit  = 0x80
+	rsvBits = 0x70
+	maskBit = 0x80
+
+	maxControlPayload = 125
+	closeTimeout      = time.Second
+)
+
+// CloseError is returned by ReadMessage once the connection is closed,
+// by the peer or because it broke the protocol.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+// Conn is a WebSocket connection. One goroutine may read while others
+// write or Close, writes are serialized.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+	opts     options
+
+	// readMu is held while reading frames, by ReadMessage or Close
+	readMu    sync.Mutex
+	writeMu   sync.Mutex
+	closeSent bool
+
+	closeMu  sync.Mutex
+	closeErr *CloseError
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool, opts options) *Conn {
+	return &Conn{
+		conn:     conn,
+		br:       br,
+		isServer: isServer,
+		opts:     opts,
+	}
+}
+
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// ReadMessage returns the next text or binary message, reassembled from its
+// fragments. Pings are answered and pongs dropped along the way. When the
+// peer closes, the close is echoed and a *CloseError returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if closeErr := c.closeError(); closeErr != nil {
+		return 0, nil, closeErr
+	}
+
+	var msgType MessageType
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame(int64(len(msg)))
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteControl(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case continuationFrame:
+			if msgType == 0 {
+				return 0, nil, c.fail(errProtocol("unexpected continuation frame"))
+			}
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, c.fail(errProtocol("expected continuation frame"))
+			}
+			msgType = opcode
+		default:
+			return 0, nil, c.fail(errProtocol("unknown opcode"))
+		}
+
+		msg = append(msg, payload...)
+		if !fin {
+			continue
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(&CloseError{CloseInvalidPayload, "invalid utf-8"})
+		}
+		return msgType, msg, nil
+	}
+}
+
+// readFrame reads one frame, buffered is the size of the message read so
+// far and counts towards the message size limit.
+func (c *Conn) readFrame(buffered int64) (fin bool, opcode MessageType, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&finBit != 0
+	opcode = MessageType(head[0] & 0x0f)
+	masked := head[1]&maskBit != 0
+
+	if head[0]&rsvBits != 0 {
+		return false, 0, nil, errProtocol("reserved bits set")
+	}
+	if masked != c.isServer {
+		return false, 0, nil, errProtocol("bad masking")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		if ext[0]&0x80 != 0 {
+			return false, 0, nil, errProtocol("bad payload length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if opcode >= CloseMessage {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, errProtocol("bad control frame")
+		}
+	} else if buffered+length > c.opts.maxMessageSize {
+		return false, 0, nil, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		mask(key, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// handleClose answers the peer's close frame and shuts the connection.
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return c.fail(errProtocol("bad close frame"))
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(errProtocol("bad close code"))
+		}
+		if !utf8.Valid(payload[2:]) {
+			return c.fail(&CloseError{CloseInvalidPayload, "invalid utf-8"})
+		}
+	}
+
+	reply := payload
+	if len(reply) > 2 {
+		reply = reply[:2]
+	}
+	c.writeClose(reply)
+	c.setCloseError(closeErr)
+	c.conn.Close()
+	return closeErr
+}
+
+// fail closes the connection after a read error, telling the peer why when
+// it broke the protocol.
+func (c *Conn) fail(err error) error {
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		c.conn.Close()
+		return err
+	}
+	c.writeClose(closePayload(closeErr.Code, closeErr.Text))
+	c.setCloseError(closeErr)
+	c.conn.Close()
+	return closeErr
+}
+
+func (c *Conn) closeError() *CloseError {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	return c.closeErr
+}
+
+// setCloseError records why the connection closed, the first reason wins
+func (c *Conn) setCloseError(closeErr *CloseError) {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closeErr == nil {
+		c.closeErr = closeErr
+	}
+}
+
+// WriteMessage sends data as a single message, fragmented when
+// WithFragmentSize is set.
+func (c *Conn) WriteMessage(msgType MessageType, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return ErrBadMessageType
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	size := c.opts.fragmentSize
+	if size <= 0 || len(data) <= size {
+		return c.writeFrame(true, msgType, data)
+	}
+	opcode := msgType
+	for len(data) > size {
+		if err := c.writeFrame(false, opcode, data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+		opcode = continuationFrame
+	}
+	return c.writeFrame(true, opcode, data)
+}
+
+// WriteControl sends a ping or pong, e.g. to keep the connection alive.
+func (c *Conn) WriteControl(msgType MessageType, data []byte) error {
+	if msgType != PingMessage && msgType != PongMessage {
+		return ErrBadMessageType
+	}
+	if len(data) > maxControlPayload {
+		return ErrControlTooLong
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	return c.writeFrame(true, msgType, data)
+}
+
+// Close starts the closing handshake with code and reason, waits briefly
+// for the peer to answer and closes the connection. Messages still arriving
+// meanwhile are dropped. A ReadMessage blocked in another goroutine returns
+// first, with the peer's answer or a timeout.
+func (c *Conn) Close(code int, reason string) error {
+	if c.closeError() != nil {
+		return c.conn.Close()
+	}
+	if err := c.writeClose(closePayload(code, reason)); err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if c.closeError() != nil {
+		// the reader got the peer's answer
+		c.conn.Close()
+		return nil
+	}
+	for {
+		_, opcode, _, err := c.readFrame(0)
+		if err != nil || opcode == CloseMessage {
+			break
+		}
+	}
+	c.setCloseError(&CloseError{Code: code, Text: reason})
+	return c.conn.Close()
+}
+
+func (c *Conn) writeClose(payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	return c.writeFrame(true, CloseMessage, payload)
+}
+
+// writeFrame must be called with writeMu held
+func (c *Conn) writeFrame(fin bool, opcode MessageType, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	b0 := byte(opcode)
+	if fin {
+		b0 |= finBit
+	}
+	frame = append(frame, b0)
+
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch n := len(payload); {
+	case n <= maxControlPayload:
+		frame = append(frame, b1|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, b1|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, b1|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var key [4]byte
+		rand.Read(key[:])
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		mask(key, frame[start:])
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func mask(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+func closePayload(code int, reason string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	return append(payload, reason...)
+}
+
+// validCloseCode reports whether a peer may send code, RFC 6455 section
+// 7.4: the registered codes that can go on the wire, and 3000-4999 for
+// libraries and applications.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < 1000 || code > 1014:
+		return false
+	}
+	// 1004 is reserved, 1005 and 1006 are never sent
+	return code != 1004 && code != CloseNoStatusReceived && code != 1006
+}
+
+func errProtocol(text string) error {
+	return &CloseError{CloseProtocolError, text}
+}
+
+var (
+	ErrBadMessageType = errors.New("websocket: bad message type")
+	ErrControlTooLong = errors.New("websocket: control frame payload too long")
+	ErrCloseSent      = errors.New("websocket: close already sent")
+)
@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+)
+
+const (
+	upgradeHeader       = "Upgrade"
+	connectionHeader    = "Connection"
+	secWebSocketKey     = "Sec-WebSocket-Key"
+	secWebSocketVersion = "Sec-WebSocket-Version"
+	secWebSocketAccept  = "Sec-WebSocket-Accept"
+	secWebSocketProto   = "Sec-WebSocket-Protocol"
+)
+
+// keyGUID is appended to the client key to compute Sec-WebSocket-Accept
+const keyGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const defaultMaxMessageSize = 1 << 20
+
+type options struct {
+	maxMessageSize int64
+	fragmentSize   int
+	subprotocols   []string
+}
+
+type Option func(*options)
+
+// WithMaxMessageSize caps the size of a received message, reassembled from
+// all its fragments, defaults to 1MiB. Peers going over it are closed
+// with 1009 Message Too Big.
+func WithMaxMessageSize(n int64) Option {
+	return func(o *options) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithFragmentSize splits outgoing messages into frames of at most n bytes.
+// Zero, the default, sends every message in a single frame.
+func WithFragmentSize(n int) Option {
+	return func(o *options) {
+		o.fragmentSize = n
+	}
+}
+
+// WithSubprotocols sets the subprotocols the server speaks, in order of
+// preference. The first one the client also offers is selected.
+func WithSubprotocols(protocols ...string) Option {
+	return func(o *options) {
+		o.subprotocols = protocols
+	}
+}
+
+// Upgrade performs the opening handshake of RFC 6455 section 4.2 and takes
+// over the connection. On a bad handshake the error response has already
+// been written, the handler can log the error and return nil.
+// The caller must Close the returned Conn.
+func Upgrade(w *response.Writer, r *request.Request, opts ...Option) (*Conn, error) {
+	o := options{maxMessageSize: defaultMaxMessageSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	key, err := checkHandshake(r)
+	if err != nil {
+		if errors.Is(err, ErrBadVersion) {
+			w.Headers().Set(secWebSocketVersion, "13")
+			return nil, reject(w, response.StatusUpgradeRequired, err)
+		}
+		return nil, reject(w, response.StatusBadRequest, err)
+	}
+
+	h := w.Headers()
+	h.Del(response.ContentType)
+	h.Set(upgradeHeader, "websocket")
+	h.Set(connectionHeader, "Upgrade")
+	h.Set(secWebSocketAccept, AcceptKey(key))
+	if proto := selectSubprotocol(r, o.subprotocols); proto != "" {
+		h.Set(secWebSocketProto, proto)
+	}
+	if err := w.WriteStatus(response.StatusSwitchingProtocols); err != nil {
+		return nil, err
+	}
+
+	conn, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, bufio.NewReader(conn), true, o), nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for the client key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + keyGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func checkHandshake(r *request.Request) (string, error) {
+	if r.Method != "GET" {
+		return "", ErrBadHandshake
+	}
+	if !hasToken(r, upgradeHeader, "websocket") || !hasToken(r, connectionHeader, "upgrade") {
+		return "", ErrBadHandshake
+	}
+	if version, _ := r.Headers.Get(secWebSocketVersion); version != "13" {
+		return "", ErrBadVersion
+	}
+	key, _ := r.Headers.Get(secWebSocketKey)
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return "", ErrBadHandshake
+	}
+	return key, nil
+}
+
+func hasToken(r *request.Request, key, token string) bool {
+	val, _ := r.Headers.Get(key)
+	for _, t := range strings.Split(val, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(r *request.Request, supported []string) string {
+	offered, _ := r.Headers.Get(secWebSocketProto)
+	for _, proto := range supported {
+		for _, t := range strings.Split(offered, ",") {
+			if strings.TrimSpace(t) == proto {
+				return proto
+			}
+		}
+	}
+	return ""
+}
+
+func reject(w *response.Writer, statusCode int, err error) error {
+	if werr := w.WriteStatus(statusCode); werr != nil {
+		return werr
+	}
+	w.Write([]byte(err.Error() + "\n"))
+	return err
+}
+
+// NewClientConn wraps a connection on which the client side of the
+// handshake has already completed, br holds whatever was read past the
+// handshake response. Client frames are masked as RFC 6455 requires.
+func NewClientConn(conn net.Conn, br *bufio.Reader, opts ...Option) *Conn {
+	o := options{maxMessageSize: defaultMaxMessageSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return newConn(conn, br, false, o)
+}
+
+var (
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	ErrBadVersion   = errors.New("websocket: unsupported version")
+)
@@ -0,0 +1,244 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yanshuy/http/internal/request"
+	"github.com/yanshuy/http/internal/response"
+	"github.com/yanshuy/http/internal/server"
+)
+
+const handshake = "GET /ws HTTP/1.1\r\n" +
+	"Host: localhost\r\n" +
+	"Upgrade: websocket\r\n" +
+	"Connection: keep-alive, Upgrade\r\n" +
+	"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+	"Sec-WebSocket-Version: 13\r\n" +
+	"\r\n"
+
+// echo sends every message back until the client closes
+func echo(opts ...Option) server.Handler {
+	return func(w *response.Writer, r *request.Request) error {
+		conn, err := Upgrade(w, r, opts...)
+		if err != nil {
+			return nil
+		}
+		defer conn.Close(CloseNormalClosure, "")
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			if err := conn.WriteMessage(msgType, msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func dial(t *testing.T, h server.Handler, opts ...Option) (*Conn, string) {
+	t.Helper()
+	s, err := server.Serve("127.0.0.1:0", h)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = io.WriteString(conn, handshake)
+	require.NoError(t, err)
+
+	br := bufio.NewReader(conn)
+	var resp strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		resp.WriteString(line)
+		if line == "\r\n" {
+			break
+		}
+	}
+	return NewClientConn(conn, br, opts...), resp.String()
+}
+
+func TestHandshake(t *testing.T) {
+	_, resp := dial(t, echo())
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 101 Switching Protocols\r\n"))
+	assert.Contains(t, resp, "sec-websocket-accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n")
+	assert.Contains(t, resp, "upgrade: websocket\r\n")
+	assert.NotContains(t, resp, "transfer-encoding")
+	assert.NotContains(t, resp, "content-length")
+}
+
+func TestBadHandshake(t *testing.T) {
+	upgrade := func(raw string) string {
+		r, err := request.RequestFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		w := response.NewResponseWriter(&buf)
+		_, err = Upgrade(w, r)
+		require.Error(t, err)
+		require.NoError(t, w.Finish())
+		return buf.String()
+	}
+
+	resp := upgrade(strings.Replace(handshake, "Upgrade: websocket", "Upgrade: h2c", 1))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+
+	resp = upgrade(strings.Replace(handshake, "Version: 13", "Version: 8", 1))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 426 Upgrade Required\r\n"))
+	assert.Contains(t, resp, "sec-websocket-version: 13\r\n")
+
+	resp = upgrade(strings.Replace(handshake, "dGhlIHNhbXBsZSBub25jZQ==", "short", 1))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+
+	// Test: Hijacking needs a connection
+	r, err := request.RequestFromReader(strings.NewReader(handshake))
+	require.NoError(t, err)
+	_, err = Upgrade(response.NewResponseWriter(&bytes.Buffer{}), r)
+	assert.Equal(t, response.ErrNotHijackable, err)
+}
+
+func TestEcho(t *testing.T) {
+	c, _ := dial(t, echo())
+
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("hello")))
+	msgType, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, msgType)
+	assert.Equal(t, "hello", string(msg))
+
+	// Test: 16 bit payload length
+	big := bytes.Repeat([]byte{0xab}, 70000)
+	require.NoError(t, c.WriteMessage(BinaryMessage, big))
+	msgType, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BinaryMessage, msgType)
+	assert.Equal(t, big, msg)
+
+	// Test: Close handshake
+	require.NoError(t, c.Close(CloseNormalClosure, "bye"))
+}
+
+func TestFragmentation(t *testing.T) {
+	c, _ := dial(t, echo(WithFragmentSize(3)))
+
+	// fragments with a ping in between
+	c.writeMu.Lock()
+	require.NoError(t, c.writeFrame(false, TextMessage, []byte("frag")))
+	require.NoError(t, c.writeFrame(true, PingMessage, []byte("ping")))
+	require.NoError(t, c.writeFrame(false, continuationFrame, []byte("men")))
+	require.NoError(t, c.writeFrame(true, continuationFrame, []byte("ted")))
+	c.writeMu.Unlock()
+
+	// the pong comes first, then the echo split in 3 byte frames
+	fin, opcode, payload, err := c.readFrame(0)
+	require.NoError(t, err)
+	assert.True(t, fin)
+	assert.Equal(t, PongMessage, opcode)
+	assert.Equal(t, "ping", string(payload))
+
+	var frames []string
+	for {
+		fin, opcode, payload, err = c.readFrame(0)
+		require.NoError(t, err)
+		if len(frames) == 0 {
+			assert.Equal(t, TextMessage, opcode)
+		} else {
+			assert.Equal(t, continuationFrame, opcode)
+		}
+		frames = append(frames, string(payload))
+		if fin {
+			break
+		}
+	}
+	assert.Equal(t, []string{"fra", "gme", "nte", "d"}, frames)
+}
+
+func TestProtocolErrors(t *testing.T) {
+	// Test: Message over the limit
+	c, _ := dial(t, echo(WithMaxMessageSize(4)))
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("too long")))
+	_, _, err := c.ReadMessage()
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+
+	// Test: Unmasked client frame
+	c, _ = dial(t, echo())
+	c.isServer = true
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("unmasked")))
+	c.isServer = false
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseProtocolError, closeErr.Code)
+
+	// Test: Invalid utf-8 text
+	c, _ = dial(t, echo())
+	require.NoError(t, c.WriteMessage(TextMessage, []byte{0xff, 0xfe}))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseInvalidPayload, closeErr.Code)
+
+	// Test: Close codes a peer must not send
+	for _, code := range []int{999, 1004, CloseNoStatusReceived, 1006, 1015, 2999, 5000} {
+		c, _ = dial(t, echo())
+		require.NoError(t, c.writeFrame(true, CloseMessage, binary.BigEndian.AppendUint16(nil, uint16(code))))
+		_, _, err = c.ReadMessage()
+		require.ErrorAs(t, err, &closeErr)
+		assert.Equal(t, CloseProtocolError, closeErr.Code, code)
+	}
+
+	// Test: Close reason that isn't utf-8
+	c, _ = dial(t, echo())
+	require.NoError(t, c.writeFrame(true, CloseMessage, append(closePayload(CloseNormalClosure, ""), 0xff)))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseInvalidPayload, closeErr.Code)
+
+	// Test: Application close codes are echoed
+	c, _ = dial(t, echo())
+	require.NoError(t, c.writeFrame(true, CloseMessage, closePayload(4000, "done")))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, 4000, closeErr.Code)
+}
+
+func TestCloseWhileReading(t *testing.T) {
+	c, _ := dial(t, echo())
+	readErr := make(chan error)
+	go func() {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("hello")))
+
+	done := make(chan error)
+	go func() { done <- c.Close(CloseGoingAway, "bye") }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * closeTimeout):
+		t.Fatal("Close blocked")
+	}
+	var closeErr *CloseError
+	require.ErrorAs(t, <-readErr, &closeErr)
+	assert.Equal(t, CloseGoingAway, closeErr.Code)
+
+	// Test: Reads after Close
+	_, _, err := c.ReadMessage()
+	assert.ErrorAs(t, err, &closeErr)
+}